@@ -0,0 +1,117 @@
+package metaname
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Ping checks connectivity and credentials with the cheapest authenticated
+// request Metaname offers, fetching the account balance. It returns nil on
+// success, an error wrapping ErrUnauthorized if the credentials are
+// rejected, or the transport error if Metaname couldn't be reached.
+func (p *Provider) Ping(ctx context.Context) error {
+	_, err := p.account_balance(ctx)
+	return err
+}
+
+// VerifyCredentials checks that Metaname accepts the Provider's account
+// reference and API key, without changing anything. It returns nil if they
+// are accepted and an error wrapping ErrUnauthorized if they are rejected or
+// missing. Any other error, such as a failure to reach Metaname, means the
+// credentials couldn't be checked.
+func (p *Provider) VerifyCredentials(ctx context.Context) error {
+	if err := p.checkCredentials(); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+	_, err := p.account_balance(ctx)
+	return err
+}
+
+// UsageInfo describes the account's standing with Metaname's API.
+type UsageInfo struct {
+	// Balance is the account balance, in New Zealand dollars.
+	Balance float64
+
+	// RateLimitReported is whether Metaname reported its rate limit on the
+	// request; the fields below are zero if not.
+	RateLimitReported bool
+	// RateLimit is how many requests are allowed in the current window.
+	RateLimit int
+	// RateLimitRemaining is how many of those requests are left.
+	RateLimitRemaining int
+	// RateLimitReset is when the window ends and the count starts over.
+	RateLimitReset time.Time
+}
+
+// Usage returns the account's balance and the rate-limit state Metaname
+// reports, from a single request for the balance. Metaname doesn't
+// document rate-limit headers, so they are read where present in the
+// common X-RateLimit-Limit, X-RateLimit-Remaining, and X-RateLimit-Reset
+// form.
+func (p *Provider) Usage(ctx context.Context) (UsageInfo, error) {
+	balance, err := p.account_balance(ctx)
+	if err != nil {
+		return UsageInfo{}, err
+	}
+	p.usageMutex.Lock()
+	rl := p.rateLimit
+	p.usageMutex.Unlock()
+	return UsageInfo{
+		Balance:            balance,
+		RateLimitReported:  rl.reported,
+		RateLimit:          rl.limit,
+		RateLimitRemaining: rl.remaining,
+		RateLimitReset:     rl.reset,
+	}, nil
+}
+
+// ListZones returns the names of the domains in the account, whose zones
+// the Provider can manage.
+func (p *Provider) ListZones(ctx context.Context) ([]string, error) {
+	return p.domain_names(ctx)
+}
+
+// ZoneExists reports whether zone is one of the domains in the account.
+func (p *Provider) ZoneExists(ctx context.Context, zone string) (bool, error) {
+	zones, err := p.ListZones(ctx)
+	if err != nil {
+		return false, err
+	}
+	name := strings.TrimSuffix(zone, ".")
+	for _, z := range zones {
+		if strings.EqualFold(strings.TrimSuffix(z, "."), name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkWritable fails with ErrReadOnly if the Provider is read-only, so
+// that a change is refused before anything is sent.
+func (p *Provider) checkWritable(zone string) error {
+	if p.ReadOnly {
+		return fmt.Errorf("%w: not changing %s", ErrReadOnly, zone)
+	}
+	return nil
+}
+
+// checkZone checks zone before it is changed: that it is a plausible name,
+// and, if CheckZoneOwnership is set, that it belongs to the account.
+func (p *Provider) checkZone(ctx context.Context, zone string) error {
+	if err := validateZone(zone); err != nil {
+		return err
+	}
+	if !p.CheckZoneOwnership {
+		return nil
+	}
+	ok, err := p.ZoneExists(ctx, zone)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrZoneNotOwned, zone)
+	}
+	return nil
+}
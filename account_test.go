@@ -0,0 +1,221 @@
+package metaname
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestPing(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	p.APIKey = "wrong"
+	if err := p.Ping(context.Background()); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized; got %v", err)
+	}
+
+	// Being a read, this is retried before the failure is reported.
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = 10 * time.Millisecond
+	p = f.provider()
+	p.Endpoint = "http://127.0.0.1:1"
+	if err := p.Ping(context.Background()); err == nil || errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected a transport error; got %v", err)
+	}
+}
+
+func TestPingWaitsForOtherRequests(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	listing, release := make(chan struct{}), make(chan struct{})
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		if method == "dns_zone" {
+			close(listing)
+			<-release
+		}
+		return false
+	}
+	p := f.provider()
+	var once sync.Once
+	defer once.Do(func() { close(release) })
+
+	done := make(chan error, 2)
+	go func() {
+		_, err := p.GetRecords(context.Background(), "example.com")
+		done <- err
+	}()
+	<-listing
+	go func() { done <- p.Ping(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+	if n := f.callCount("account_balance"); n != 0 {
+		t.Fatalf("expected Ping to wait for the listing in progress; got %d account_balance calls", n)
+	}
+	once.Do(func() { close(release) })
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWaitingRequestGivesUpWithContext(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	listing, release := make(chan struct{}), make(chan struct{})
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		if method == "dns_zone" {
+			close(listing)
+			<-release
+		}
+		return false
+	}
+	p := f.provider()
+	var once sync.Once
+	defer once.Do(func() { close(release) })
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.GetRecords(context.Background(), "example.com")
+		done <- err
+	}()
+	<-listing
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Ping(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected Ping to give up waiting when its context expired; got %v", err)
+	}
+	if n := f.callCount("account_balance"); n != 0 {
+		t.Fatalf("expected no account_balance calls; got %d", n)
+	}
+	once.Do(func() { close(release) })
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetryWaitDoesNotHoldUpOthers(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	limited := make(chan struct{})
+	var once sync.Once
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		handled := false
+		if method == "dns_zone" {
+			once.Do(func() {
+				writeRPCErrorData(w, -32000, "Rate limit exceeded", map[string]interface{}{"retry_after": 2})
+				close(limited)
+				handled = true
+			})
+		}
+		return handled
+	}
+	p := f.provider()
+	p.MaxRetries = 1
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.GetRecords(context.Background(), "example.com")
+		done <- err
+	}()
+	<-limited
+	start := time.Now()
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected Ping to go ahead while the listing waited to retry; took %s", elapsed)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyCredentials(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+	if err := p.VerifyCredentials(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	p.AccountReference = "zz99"
+	if err := p.VerifyCredentials(context.Background()); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized for a wrong account reference; got %v", err)
+	}
+
+	p.AccountReference = ""
+	if err := p.VerifyCredentials(context.Background()); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized for a missing account reference; got %v", err)
+	}
+
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = 10 * time.Millisecond
+	p = f.provider()
+	p.Endpoint = "http://127.0.0.1:1"
+	if err := p.VerifyCredentials(context.Background()); err == nil || errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected a transport error; got %v", err)
+	}
+	if n := f.callCount("account_balance"); n != 2 {
+		t.Fatalf("expected 2 account_balance calls; got %d", n)
+	}
+}
+
+func TestZoneOwnershipGuard(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	zones, err := p.ListZones(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zones) != 1 || zones[0] != "example.com" {
+		t.Fatalf("expected the account's one zone; got %v", zones)
+	}
+	if ok, err := p.ZoneExists(context.Background(), "Example.com."); err != nil || !ok {
+		t.Fatalf("expected example.com to exist; got %v, %v", ok, err)
+	}
+
+	p.CheckZoneOwnership = true
+	records := []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.1", TTL: time.Hour}}
+	if _, err := p.AppendRecords(context.Background(), "exmaple.com", records); !errors.Is(err, ErrZoneNotOwned) {
+		t.Fatalf("expected ErrZoneNotOwned for a mistyped zone; got %v", err)
+	}
+	if n := f.callCount("create_dns_record"); n != 0 {
+		t.Fatalf("expected nothing to be sent for the unowned zone; got %d creates", n)
+	}
+	if _, err := p.AppendRecords(context.Background(), "example.com", records); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	usage, err := p.Usage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Balance != 42.5 || usage.RateLimitReported {
+		t.Fatalf("expected the balance and no rate limit; got %+v", usage)
+	}
+
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		w.Header().Set("X-RateLimit-Limit", "100")
+		w.Header().Set("X-RateLimit-Remaining", "37")
+		w.Header().Set("X-RateLimit-Reset", "1700000000")
+		return false
+	}
+	if usage, err = p.Usage(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !usage.RateLimitReported || usage.RateLimit != 100 || usage.RateLimitRemaining != 37 || usage.RateLimitReset.Unix() != 1700000000 {
+		t.Fatalf("expected the reported rate limit; got %+v", usage)
+	}
+}
@@ -0,0 +1,437 @@
+package metaname
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// supportedTypes are the record types this provider models: each is read
+// by GetRecords and written by AppendRecords and SetRecords alike.
+// Reconciliation leaves records of any other type alone unless
+// DeleteUnsupportedTypes is set, since the caller's desired set can't be
+// expected to describe them. The forwarding pseudo-types are the one
+// exception to symmetry, listed when asked for but never written.
+var supportedTypes = map[string]bool{
+	"A":      true,
+	"AAAA":   true,
+	"CNAME":  true,
+	"MX":     true,
+	"NS":     true,
+	"PTR":    true,
+	"SMIMEA": true,
+	"SRV":    true,
+	"TXT":    true,
+}
+
+// ZoneDiff describes the changes that bring a zone's records in line with
+// a desired set.
+type ZoneDiff struct {
+	// Unchanged are desired records already present as they are, with the
+	// IDs of the existing records.
+	Unchanged []libdns.Record
+	// Updates are existing records to be changed in place.
+	Updates []RecordUpdate
+	// Creates are desired records to be created.
+	Creates []libdns.Record
+	// Deletes are existing records to be deleted.
+	Deletes []libdns.Record
+}
+
+// RecordUpdate pairs an existing record with the desired record it is to
+// be updated to. Desired carries the existing record's ID.
+type RecordUpdate struct {
+	Existing libdns.Record
+	Desired  libdns.Record
+}
+
+// DiffRecords works out the changes ApplyZone would make to bring a zone
+// holding existing in line with desired. Unlike PlanZone it knows nothing
+// of the zone beyond the records given, so its Deletes include records
+// ApplyZone would preserve, such as those of unmodelled types.
+func DiffRecords(existing, desired []libdns.Record) ZoneDiff {
+	custom := make([]CustomRecord, len(existing))
+	for i, rec := range existing {
+		custom[i] = CustomRecord{Record: rec, stored: toMetanameRR(rec)}
+	}
+	return planReconcile(custom, desired, true).diff()
+}
+
+// ApplyZone reconciles the whole zone against desired, as SetRecords does
+// for each name and type in desired, and additionally deletes any existing
+// record whose name and type don't appear in desired. It returns the
+// records that were set.
+//
+// Existing records of a type the provider doesn't model, and records
+// Metaname manages itself, are never deleted unless the Provider's
+// DeleteUnsupportedTypes or DeleteSystemRecords option respectively is set.
+func (p *Provider) ApplyZone(ctx context.Context, zone string, desired []libdns.Record) ([]libdns.Record, error) {
+	ctx = p.withRetryBudget(ctx)
+	if err := p.checkWritable(zone); err != nil {
+		return nil, err
+	}
+	plan, err := p.planZone(ctx, zone, desired)
+	if err != nil {
+		return nil, err
+	}
+	return p.applyPlan(ctx, zone, plan)
+}
+
+// PlanZone reports, without changing anything, what ApplyZone would do
+// given desired.
+func (p *Provider) PlanZone(ctx context.Context, zone string, desired []libdns.Record) (ZoneDiff, error) {
+	plan, err := p.planZone(ctx, zone, desired)
+	if err != nil {
+		return ZoneDiff{}, err
+	}
+	return plan.diff(), nil
+}
+
+// Kinds of Discrepancy.
+const (
+	DiscrepancyMissing       = "missing"
+	DiscrepancyExtra         = "extra"
+	DiscrepancyValueMismatch = "value-mismatch"
+	DiscrepancyTTLMismatch   = "ttl-mismatch"
+)
+
+// Discrepancy is one way a zone differs from a desired set of records.
+type Discrepancy struct {
+	// Kind is DiscrepancyMissing for a desired record the zone lacks,
+	// DiscrepancyExtra for a record in the zone that isn't desired, and
+	// DiscrepancyValueMismatch or DiscrepancyTTLMismatch for a record that
+	// is present but with another value or TTL.
+	Kind string
+	// Desired is the desired record; it is empty for an extra record.
+	Desired libdns.Record
+	// Live is the record in the zone; it is empty for a missing record.
+	Live libdns.Record
+}
+
+// CheckConsistency reports, without changing anything, each way the zone
+// differs from desired, judged as ApplyZone would judge it: records
+// ApplyZone would leave alone aren't reported as extra. A zone that
+// matches gives no discrepancies.
+func (p *Provider) CheckConsistency(ctx context.Context, zone string, desired []libdns.Record) ([]Discrepancy, error) {
+	diff, err := p.PlanZone(ctx, zone, desired)
+	if err != nil {
+		return nil, err
+	}
+	var discrepancies []Discrepancy
+	for _, u := range diff.Updates {
+		kind := DiscrepancyValueMismatch
+		if recordsMatch(u.Existing, u.Desired) {
+			kind = DiscrepancyTTLMismatch
+		}
+		discrepancies = append(discrepancies, Discrepancy{Kind: kind, Desired: u.Desired, Live: u.Existing})
+	}
+	for _, rec := range diff.Creates {
+		discrepancies = append(discrepancies, Discrepancy{Kind: DiscrepancyMissing, Desired: rec})
+	}
+	for _, rec := range diff.Deletes {
+		discrepancies = append(discrepancies, Discrepancy{Kind: DiscrepancyExtra, Live: rec})
+	}
+	return discrepancies, nil
+}
+
+func (p *Provider) planZone(ctx context.Context, zone string, desired []libdns.Record) (reconcilePlan, error) {
+	if err := p.checkZone(ctx, zone); err != nil {
+		return reconcilePlan{}, err
+	}
+	desired = p.normalizeRecords(zone, desired)
+	if err := validateRecords(desired); err != nil {
+		return reconcilePlan{}, err
+	}
+	existing, err := p.GetCustomRecords(WithoutCache(ctx), zone)
+	if err != nil {
+		return reconcilePlan{}, err
+	}
+	plan := planReconcile(existing, desired, true)
+	plan.deletes = p.deletable(plan.deletes)
+	return plan, nil
+}
+
+// deletable filters records down to those reconciliation may delete.
+func (p *Provider) deletable(records []CustomRecord) []CustomRecord {
+	var out []CustomRecord
+	for _, cur := range records {
+		if !supportedTypes[cur.Type] && !p.DeleteUnsupportedTypes {
+			continue
+		}
+		if cur.Metadata["origin"] == "system" && !p.DeleteSystemRecords {
+			continue
+		}
+		out = append(out, cur)
+	}
+	return out
+}
+
+// rrsetKey identifies the set of records sharing a name and type.
+type rrsetKey struct {
+	name  string
+	rtype string
+}
+
+// keyOf returns the key of the set rec belongs to, with the name lowercased
+// so that names differing only in case share a set.
+func keyOf(rec libdns.Record) rrsetKey {
+	return rrsetKey{strings.ToLower(rec.Name), rec.Type}
+}
+
+// recordUpdate is an existing record to be updated to desired.
+type recordUpdate struct {
+	existing CustomRecord
+	desired  libdns.Record
+}
+
+// reconcilePlan is the set of changes reconciliation will make.
+type reconcilePlan struct {
+	unchanged []libdns.Record
+	updates   []recordUpdate
+	creates   []libdns.Record
+	deletes   []CustomRecord
+}
+
+// diff describes the plan in exported terms.
+func (plan reconcilePlan) diff() ZoneDiff {
+	d := ZoneDiff{Unchanged: plan.unchanged, Creates: plan.creates}
+	for _, u := range plan.updates {
+		d.Updates = append(d.Updates, RecordUpdate{Existing: u.existing.Record, Desired: u.desired})
+	}
+	for _, cur := range plan.deletes {
+		d.Deletes = append(d.Deletes, cur.Record)
+	}
+	return d
+}
+
+// planReconcile works out how to make the records of each name and type in
+// desired match it, reusing existing references wherever possible: records
+// given an ID are updated directly, desired records matching an existing
+// value are kept, remaining desired records take over remaining existing
+// references by update, and only then are new records created and true
+// extras deleted. If pruneOthers is set, existing records of names and
+// types absent from desired are deleted too.
+func planReconcile(existing []CustomRecord, desired []libdns.Record, pruneOthers bool) reconcilePlan {
+	var plan reconcilePlan
+
+	claimed := make(map[string]bool)
+	var keys []rrsetKey
+	groups := make(map[rrsetKey][]libdns.Record)
+	for _, rec := range desired {
+		if rec.ID != "" {
+			claimed[rec.ID] = true
+			continue
+		}
+		key := keyOf(rec)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], rec)
+	}
+
+	byID := make(map[string]CustomRecord)
+	for _, cur := range existing {
+		byID[cur.ID] = cur
+	}
+	for _, rec := range desired {
+		if rec.ID == "" {
+			continue
+		}
+		cur, ok := byID[rec.ID]
+		if !ok {
+			// Not in the listing, but Metaname may still know the ID.
+			cur = CustomRecord{Record: libdns.Record{ID: rec.ID}, stored: metanameRR{Aux: -1}}
+		}
+		plan.updates = append(plan.updates, recordUpdate{cur, rec})
+	}
+
+	for _, key := range keys {
+		var candidates []CustomRecord
+		for _, cur := range existing {
+			if !claimed[cur.ID] && keyOf(cur.Record) == key {
+				candidates = append(candidates, cur)
+			}
+		}
+
+		// Keep records whose value is already present.
+		var unmatched []libdns.Record
+		for _, rec := range groups[key] {
+			match := -1
+			for i, cur := range candidates {
+				if !claimed[cur.ID] && recordsMatch(cur.Record, rec) {
+					match = i
+					break
+				}
+			}
+			if match < 0 {
+				unmatched = append(unmatched, rec)
+				continue
+			}
+			cur := candidates[match]
+			claimed[cur.ID] = true
+			rec.ID = cur.ID
+			if !ttlMatches(cur.Record, rec) {
+				plan.updates = append(plan.updates, recordUpdate{cur, rec})
+			} else {
+				rec.TTL = cur.TTL
+				plan.unchanged = append(plan.unchanged, rec)
+			}
+		}
+
+		// Move the leftover existing records onto the new values in place,
+		// so the name never has fewer records than it should.
+		for _, cur := range candidates {
+			if claimed[cur.ID] {
+				continue
+			}
+			if len(unmatched) == 0 {
+				plan.deletes = append(plan.deletes, cur)
+				continue
+			}
+			rec := unmatched[0]
+			unmatched = unmatched[1:]
+			claimed[cur.ID] = true
+			rec.ID = cur.ID
+			plan.updates = append(plan.updates, recordUpdate{cur, rec})
+		}
+		plan.creates = append(plan.creates, unmatched...)
+	}
+
+	if pruneOthers {
+		for _, cur := range existing {
+			if _, ok := groups[keyOf(cur.Record)]; !ok && !claimed[cur.ID] {
+				plan.deletes = append(plan.deletes, cur)
+			}
+		}
+	}
+
+	return plan
+}
+
+// ApplyError reports a reconciliation that failed partway, after some of
+// its changes were made, so the caller can see what state the zone was
+// left in. Metaname has no transactions, so the changes already made
+// aren't undone.
+type ApplyError struct {
+	// Err is the failure that stopped the reconciliation.
+	Err error
+	// Updated, Created, and Deleted are the changes made before it.
+	Updated []libdns.Record
+	Created []libdns.Record
+	Deleted []libdns.Record
+	// Remaining is how many planned changes weren't made.
+	Remaining int
+}
+
+func (e *ApplyError) Error() string {
+	return fmt.Sprintf("%v (after %d updates, %d creates, and %d deletes; %d changes not made)",
+		e.Err, len(e.Updated), len(e.Created), len(e.Deleted), e.Remaining)
+}
+
+func (e *ApplyError) Unwrap() error {
+	return e.Err
+}
+
+// applyPlan carries out plan, returning the records that were set.
+// Updates and creates come first and deletions last, so the zone never
+// holds fewer records than it should while the new ones are being made. If
+// the context ends or a change fails partway, the records set so far are
+// returned with an *ApplyError describing the progress made.
+func (p *Provider) applyPlan(ctx context.Context, zone string, plan reconcilePlan) ([]libdns.Record, error) {
+	set := append([]libdns.Record(nil), plan.unchanged...)
+
+	if p.ConditionalUpdates && len(plan.updates) > 0 {
+		if err := p.checkUnchanged(ctx, zone, plan.updates); err != nil {
+			return nil, err
+		}
+	}
+
+	progress := &ApplyError{Remaining: len(plan.updates) + len(plan.creates) + len(plan.deletes)}
+	fail := func(err error) ([]libdns.Record, error) {
+		progress.Err = err
+		return set, progress
+	}
+
+	for _, u := range plan.updates {
+		if err := ctx.Err(); err != nil {
+			return fail(err)
+		}
+		u.desired = p.normalizeUpdate(zone, u.existing.stored, u.desired)
+		if err := p.rpc().update_dns_record(ctx, zone, u.existing.ID, overlayMetanameRR(u.existing.stored, u.desired)); err != nil {
+			return fail(recordError("update", zone, u.desired, err))
+		}
+		set = append(set, u.desired)
+		progress.Updated = append(progress.Updated, u.desired)
+		progress.Remaining--
+		p.updated(zone, u.desired, u.existing.ID)
+	}
+
+	for _, rec := range plan.creates {
+		if err := ctx.Err(); err != nil {
+			return fail(err)
+		}
+		rec = p.withDefaultTTL(rec)
+		ref, err := p.rpc().create_dns_record(ctx, zone, toMetanameRR(rec))
+		if err != nil {
+			return fail(recordError("create", zone, rec, err))
+		}
+		rec.ID = ref
+		set = append(set, rec)
+		progress.Created = append(progress.Created, rec)
+		progress.Remaining--
+		p.created(zone, rec, ref)
+	}
+
+	for _, cur := range plan.deletes {
+		if err := ctx.Err(); err != nil {
+			return fail(err)
+		}
+		if _, err := p.rpc().delete_dns_record(ctx, zone, cur.ID); err != nil {
+			return fail(recordError("delete", zone, cur.Record, err))
+		}
+		progress.Deleted = append(progress.Deleted, cur.Record)
+		progress.Remaining--
+		p.deleted(zone, cur.Record, cur.ID)
+	}
+
+	return set, nil
+}
+
+// checkUnchanged rereads the zone and checks that each record to be
+// updated still has the version it had when the plan was made.
+func (p *Provider) checkUnchanged(ctx context.Context, zone string, updates []recordUpdate) error {
+	current, err := p.rpc().dns_zone(WithoutCache(ctx), zone)
+	if err != nil {
+		return err
+	}
+	versions := make(map[string]string, len(current))
+	for _, mrec := range current {
+		versions[mrec.Reference] = recordVersion(mrec)
+	}
+	for _, u := range updates {
+		version, ok := u.existing.Metadata["version"]
+		if !ok {
+			// Given by ID without being in the listing; there is nothing
+			// to compare against.
+			continue
+		}
+		if versions[u.existing.ID] != version {
+			return recordError("update", zone, u.existing.Record, ErrRecordChanged)
+		}
+	}
+	return nil
+}
+
+// isSystemRecord reports whether Metaname manages rec, read from zone,
+// itself: the zone's SOA and apex NS records, deleting which would break
+// the zone or its delegation. Metaname's API marks no records as its own,
+// so these are recognised by type and name alone, the apex however
+// Metaname names it.
+func isSystemRecord(rec metanameRR, zone string) bool {
+	if rec.Type == "SOA" {
+		return true
+	}
+	return rec.Type == "NS" && relativeName(rec.Name, zone) == ""
+}
@@ -0,0 +1,523 @@
+package metaname
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestApplyZonePreservesUnsupportedTypes(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 3600, "data": "127.0.0.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "host", "type": "SSHFP", "ttl": 3600, "data": "1 1 123456789abcdef"})
+	p := f.provider()
+
+	_, err := p.ApplyZone(context.Background(), "example.com", []libdns.Record{
+		{Name: "api", Type: "A", Value: "127.0.0.2", TTL: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	types := map[string]bool{}
+	for _, rec := range f.records("example.com") {
+		types[rec["name"].(string)+" "+rec["type"].(string)] = true
+	}
+	if !types["host SSHFP"] {
+		t.Fatal("expected SSHFP record to survive reconciliation")
+	}
+	if types["www A"] {
+		t.Fatal("expected undesired A record to be deleted")
+	}
+	if !types["api A"] {
+		t.Fatal("expected desired A record to be created")
+	}
+
+	p.DeleteUnsupportedTypes = true
+	_, err = p.ApplyZone(context.Background(), "example.com", []libdns.Record{
+		{Name: "api", Type: "A", Value: "127.0.0.2", TTL: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range f.records("example.com") {
+		if rec["type"] == "SSHFP" {
+			t.Fatal("expected SSHFP record to be deleted when DeleteUnsupportedTypes is set")
+		}
+	}
+}
+
+func TestReconcileUpdatesInPlace(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	ref1 := f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	ref2 := f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.2"})
+	ref3 := f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.3"})
+	p := f.provider()
+
+	set, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300 * time.Second},
+		{Name: "www", Type: "A", Value: "192.0.2.4", TTL: 300 * time.Second},
+		{Name: "www", Type: "A", Value: "192.0.2.3", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != 3 {
+		t.Fatalf("expected 3 records set; got %d", len(set))
+	}
+	if n := f.callCount("update_dns_record"); n != 1 {
+		t.Fatalf("expected only the changed value to be updated; got %d updates", n)
+	}
+	if n := f.callCount("create_dns_record") + f.callCount("delete_dns_record"); n != 0 {
+		t.Fatalf("expected no creates or deletes; got %d", n)
+	}
+	byRef := map[string]string{}
+	for _, rec := range f.records("example.com") {
+		byRef[rec["reference"].(string)] = rec["data"].(string)
+	}
+	if byRef[ref1] != "192.0.2.1" || byRef[ref2] != "192.0.2.4" || byRef[ref3] != "192.0.2.3" {
+		t.Fatalf("unexpected zone contents %v", byRef)
+	}
+
+	// Through ApplyZone, dropping a value deletes only that one record.
+	_, err = p.ApplyZone(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300 * time.Second},
+		{Name: "www", Type: "A", Value: "192.0.2.4", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := f.callCount("delete_dns_record"); n != 1 {
+		t.Fatalf("expected 1 delete; got %d", n)
+	}
+	if n := f.callCount("update_dns_record"); n != 1 {
+		t.Fatalf("expected no further updates; got %d in total", n)
+	}
+}
+
+func TestApplyZoneSkipsSystemRecords(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "NS", "ttl": 86400, "data": "ns1.metaname.net."})
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "SOA", "ttl": 86400, "data": "ns1.metaname.net. hostmaster.metaname.net. 1 7200 900 1209600 300"})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	p := f.provider()
+
+	records, err := p.GetCustomRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range records {
+		want := "system"
+		if rec.Name == "www" {
+			want = "user"
+		}
+		if rec.Metadata["origin"] != want {
+			t.Fatalf("expected %s %s to have origin %s; got %q", rec.Name, rec.Type, want, rec.Metadata["origin"])
+		}
+	}
+
+	if _, err := p.ApplyZone(context.Background(), "example.com", nil); err != nil {
+		t.Fatal(err)
+	}
+	remaining := f.records("example.com")
+	if len(remaining) != 2 {
+		t.Fatalf("expected the 2 system records to remain; got %v", remaining)
+	}
+	for _, rec := range remaining {
+		if rec["name"] == "www" {
+			t.Fatal("expected user record to be deleted")
+		}
+	}
+}
+
+func TestApplyZoneKeepsQualifiedApexNS(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "example.com.", "type": "NS", "ttl": 86400, "data": "ns1.metaname.net."})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	p := f.provider()
+
+	if _, err := p.ApplyZone(context.Background(), "example.com", nil); err != nil {
+		t.Fatal(err)
+	}
+	remaining := f.records("example.com")
+	if len(remaining) != 1 || remaining[0]["type"] != "NS" {
+		t.Fatalf("expected only the apex NS record to remain; got %v", remaining)
+	}
+}
+
+func TestSetRecordsMixedTypesOneName(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "A", "ttl": 300, "data": "192.0.2.9"})
+	p := f.provider()
+
+	set, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "@", Type: "A", Value: "192.0.2.1", TTL: 300 * time.Second},
+		{Name: "@", Type: "TXT", Value: "v=spf1 mx -all", TTL: 300 * time.Second},
+		{Name: "@", Type: "MX", Value: "10 mail.example.com.", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != 3 {
+		t.Fatalf("expected 3 records set; got %d", len(set))
+	}
+	types := map[string]int{}
+	for _, rec := range f.records("example.com") {
+		if rec["name"] == "@" {
+			types[rec["type"].(string)]++
+		}
+	}
+	if types["A"] != 1 || types["TXT"] != 1 || types["MX"] != 1 {
+		t.Fatalf("expected one each of A, TXT, and MX at the apex; got %v", types)
+	}
+}
+
+func TestUpdatePreservesStoredFields(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	ref := f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "MX", "ttl": 3600, "aux": 10, "data": "mx1.example.net.", "note": "primary"})
+	txt := f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "TXT", "ttl": 600, "aux": nil, "data": "old"})
+	p := f.provider()
+
+	_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		{ID: ref, Name: "", Type: "MX", Value: "mx2.example.net.", TTL: time.Hour},
+		{ID: txt, Value: "new"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range f.records("example.com") {
+		switch rec["reference"] {
+		case ref:
+			if rec["data"] != "mx2.example.net." {
+				t.Fatalf("expected MX data to be updated; got %v", rec["data"])
+			}
+			if rec["aux"] != float64(10) || rec["note"] != "primary" {
+				t.Fatalf("expected MX aux and note to be untouched; got %v", rec)
+			}
+		case txt:
+			if rec["data"] != "new" || rec["name"] != "www" || rec["type"] != "TXT" || rec["ttl"] != float64(600) {
+				t.Fatalf("expected only the TXT value to change; got %v", rec)
+			}
+		}
+	}
+}
+
+func TestPartialUpdateSplitsAux(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	mx := f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "MX", "ttl": 3600, "aux": 10, "data": "mx1.example.net."})
+	srv := f.addRecord("example.com", map[string]interface{}{"name": "_sip._tcp", "type": "SRV", "ttl": 3600, "aux": 10, "data": "20 5060 sip.example.net."})
+	p := f.provider()
+
+	if _, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		{ID: mx, Value: "20 mx2.example.net"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.UpdateRecords(context.Background(), "example.com", map[string]libdns.Record{
+		srv: {Value: "5 30 5061 sip2.example.net"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range f.records("example.com") {
+		switch rec["reference"] {
+		case mx:
+			if rec["aux"] != float64(20) || rec["data"] != "mx2.example.net." {
+				t.Fatalf("expected the MX preference in aux and a qualified target; got %v", rec)
+			}
+		case srv:
+			if rec["aux"] != float64(5) || rec["data"] != "30 5061 sip2.example.net." {
+				t.Fatalf("expected the SRV priority in aux and a qualified target; got %v", rec)
+			}
+		}
+	}
+
+	records, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range records {
+		if rec.Type == "MX" && rec.Value != "20 mx2.example.net." {
+			t.Fatalf("expected the MX to read back as written; got %q", rec.Value)
+		}
+	}
+}
+
+func TestUpdateOfUnlistedIDSendsNoAux(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	ref := f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	var sent []map[string]interface{}
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		switch method {
+		case "dns_zone":
+			// The record was created since, so the listing doesn't hold it.
+			writeRPCResult(w, []map[string]interface{}{})
+			return true
+		case "update_dns_record":
+			var rec map[string]interface{}
+			json.Unmarshal(params[4], &rec)
+			sent = append(sent, rec)
+		}
+		return false
+	}
+	p := f.provider()
+
+	if _, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		{ID: ref, Name: "www", Type: "A", Value: "192.0.2.9", TTL: 300 * time.Second},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.UpdateRecords(context.Background(), "example.com", map[string]libdns.Record{
+		ref: {Name: "www", Type: "A", Value: "192.0.2.8", TTL: 300 * time.Second},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 2 {
+		t.Fatalf("expected two updates; got %v", sent)
+	}
+	for _, rec := range sent {
+		if _, ok := rec["aux"]; ok {
+			t.Fatalf("expected no aux sent for an A record; got %v", rec)
+		}
+	}
+}
+
+func TestDiffRecords(t *testing.T) {
+	existing := []libdns.Record{
+		{ID: "1", Name: "www", Type: "A", Value: "192.0.2.1", TTL: time.Hour},
+		{ID: "2", Name: "www", Type: "A", Value: "192.0.2.2", TTL: time.Hour},
+		{ID: "3", Name: "old", Type: "TXT", Value: "gone", TTL: time.Hour},
+		{ID: "4", Name: "ttl", Type: "TXT", Value: "same", TTL: time.Hour},
+	}
+	diff := DiffRecords(existing, []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: time.Hour},
+		{Name: "www", Type: "A", Value: "192.0.2.3", TTL: time.Hour},
+		{Name: "ttl", Type: "TXT", Value: "same", TTL: time.Minute},
+		{Name: "new", Type: "TXT", Value: "fresh", TTL: time.Hour},
+	})
+	if len(diff.Unchanged) != 1 || diff.Unchanged[0].ID != "1" {
+		t.Fatalf("unexpected unchanged records %v", diff.Unchanged)
+	}
+	if len(diff.Updates) != 2 {
+		t.Fatalf("expected 2 updates; got %v", diff.Updates)
+	}
+	for _, u := range diff.Updates {
+		if u.Desired.ID != u.Existing.ID {
+			t.Fatalf("expected update to keep the existing ID; got %+v", u)
+		}
+	}
+	if len(diff.Creates) != 1 || diff.Creates[0].Name != "new" {
+		t.Fatalf("unexpected creates %v", diff.Creates)
+	}
+	if len(diff.Deletes) != 1 || diff.Deletes[0].ID != "3" {
+		t.Fatalf("unexpected deletes %v", diff.Deletes)
+	}
+}
+
+func TestPlanZoneChangesNothing(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	p := f.provider()
+
+	diff, err := p.PlanZone(context.Background(), "example.com", []libdns.Record{
+		{Name: "api", Type: "A", Value: "192.0.2.2", TTL: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Creates) != 1 || len(diff.Deletes) != 1 {
+		t.Fatalf("unexpected plan %+v", diff)
+	}
+	if n := len(f.calls); n != 1 {
+		t.Fatalf("expected only the zone listing; got %v", f.calls)
+	}
+}
+
+func TestSetRecordsZeroTTLLeavesTTLAlone(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	p := f.provider()
+
+	set, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := f.callCount("update_dns_record"); n != 0 {
+		t.Fatalf("expected no update for a matching value without a TTL; got %d", n)
+	}
+	if len(set) != 1 || set[0].TTL != 300*time.Second {
+		t.Fatalf("expected the existing record with its TTL; got %+v", set)
+	}
+}
+
+func TestSetRecordsWithMemoryClient(t *testing.T) {
+	m := &memoryRPC{records: []metanameRR{
+		{Reference: "a", Name: "www", Type: "A", Aux: -1, Ttl: 300, Data: "192.0.2.1"},
+		{Reference: "b", Name: "www", Type: "A", Aux: -1, Ttl: 300, Data: "192.0.2.2"},
+		{Reference: "c", Name: "www", Type: "A", Aux: -1, Ttl: 300, Data: "192.0.2.3"},
+		{Reference: "d", Name: "mail", Type: "A", Aux: -1, Ttl: 300, Data: "192.0.2.9"},
+	}}
+	p := &Provider{client: m}
+
+	set, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.2", TTL: 300 * time.Second},
+		{Name: "www", Type: "A", Value: "192.0.2.4", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != 2 {
+		t.Fatalf("expected 2 records set; got %+v", set)
+	}
+	want := []string{"dns_zone", "update 192.0.2.4", "delete c"}
+	if len(m.ops) != len(want) {
+		t.Fatalf("expected operations %v; got %v", want, m.ops)
+	}
+	for i := range want {
+		if m.ops[i] != want[i] {
+			t.Fatalf("expected operations %v; got %v", want, m.ops)
+		}
+	}
+	values := map[string]string{}
+	for _, rec := range m.records {
+		values[rec.Reference] = rec.Data
+	}
+	if len(values) != 3 || values["a"] != "192.0.2.4" || values["b"] != "192.0.2.2" || values["d"] != "192.0.2.9" {
+		t.Fatalf("unexpected zone contents %v", values)
+	}
+}
+
+func TestConditionalUpdateDetectsConcurrentChange(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	ref := f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	listings := 0
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		if method == "dns_zone" {
+			listings++
+			if listings == 2 {
+				// Another client changes the record after it was read.
+				f.setField("example.com", ref, "data", "192.0.2.9")
+			}
+		}
+		return false
+	}
+	p := f.provider()
+	p.ConditionalUpdates = true
+
+	_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.2", TTL: 300 * time.Second},
+	})
+	if !errors.Is(err, ErrRecordChanged) {
+		t.Fatalf("expected ErrRecordChanged; got %v", err)
+	}
+	if n := f.callCount("update_dns_record"); n != 0 {
+		t.Fatalf("expected no update over the concurrent change; got %d", n)
+	}
+
+	// Without a concurrent change the update goes ahead.
+	if _, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.2", TTL: 300 * time.Second},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.callCount("update_dns_record"); n != 1 {
+		t.Fatalf("expected the update to be made; got %d", n)
+	}
+}
+
+func TestApplyOrderAndProgress(t *testing.T) {
+	m := &memoryRPC{records: []metanameRR{
+		{Reference: "a", Name: "www", Type: "A", Aux: -1, Ttl: 300, Data: "192.0.2.1"},
+		{Reference: "b", Name: "old", Type: "A", Aux: -1, Ttl: 300, Data: "192.0.2.8"},
+	}}
+	p := &Provider{client: m}
+
+	if _, err := p.ApplyZone(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.2", TTL: 300 * time.Second},
+		{Name: "api", Type: "A", Value: "192.0.2.3", TTL: 300 * time.Second},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"dns_zone", "update 192.0.2.2", "create 192.0.2.3", "delete b"}
+	if len(m.ops) != len(want) {
+		t.Fatalf("expected operations %v; got %v", want, m.ops)
+	}
+	for i := range want {
+		if m.ops[i] != want[i] {
+			t.Fatalf("expected operations %v; got %v", want, m.ops)
+		}
+	}
+
+	// A failure partway reports what was done before it.
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "old", "type": "A", "ttl": 300, "data": "192.0.2.8"})
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		if method != "delete_dns_record" {
+			return false
+		}
+		writeRPCError(w, -32000, "Internal error")
+		return true
+	}
+	set, err := f.provider().ApplyZone(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.2", TTL: 300 * time.Second},
+		{Name: "api", Type: "A", Value: "192.0.2.3", TTL: 300 * time.Second},
+	})
+	var applyErr *ApplyError
+	if !errors.As(err, &applyErr) {
+		t.Fatalf("expected an *ApplyError; got %v", err)
+	}
+	if len(applyErr.Updated) != 1 || len(applyErr.Created) != 1 || len(applyErr.Deleted) != 0 || applyErr.Remaining != 1 {
+		t.Fatalf("unexpected progress %+v", applyErr)
+	}
+	if len(set) != 2 {
+		t.Fatalf("expected the 2 records set before the failure; got %+v", set)
+	}
+}
+
+func TestCheckConsistency(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "SOA", "ttl": 3600, "data": "ns1.metaname.net. hostmaster.metaname.net. 1 3600 900 604800 300"})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "api", "type": "A", "ttl": 3600, "data": "192.0.2.2"})
+	f.addRecord("example.com", map[string]interface{}{"name": "old", "type": "A", "ttl": 3600, "data": "192.0.2.3"})
+	f.addRecord("example.com", map[string]interface{}{"name": "", "type": "TXT", "ttl": 3600, "data": "v=spf1 -all"})
+	p := f.provider()
+
+	discrepancies, err := p.CheckConsistency(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: time.Hour},
+		{Name: "api", Type: "A", Value: "192.0.2.9", TTL: time.Hour},
+		{Name: "mail", Type: "A", Value: "192.0.2.4", TTL: time.Hour},
+		{Name: "", Type: "TXT", Value: "v=spf1 -all", TTL: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]string)
+	for _, d := range discrepancies {
+		name := d.Desired.Name
+		if d.Kind == DiscrepancyExtra {
+			name = d.Live.Name
+		}
+		found[name] = d.Kind
+	}
+	want := map[string]string{
+		"www":  DiscrepancyTTLMismatch,
+		"api":  DiscrepancyValueMismatch,
+		"mail": DiscrepancyMissing,
+		"old":  DiscrepancyExtra,
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Fatalf("expected %v; got %v", want, found)
+	}
+	if n := len(f.calls); n != 1 {
+		t.Fatalf("expected only the zone listing; got %v", f.calls)
+	}
+}
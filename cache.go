@@ -0,0 +1,77 @@
+package metaname
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// cachedZone is a zone listing kept for CacheTTL.
+type cachedZone struct {
+	records []metanameRR
+	fetched time.Time
+	expires time.Time
+}
+
+// noCacheKey is the context key marking a call that must not be answered
+// from the cache.
+type noCacheKey struct{}
+
+// WithoutCache returns a copy of ctx that makes any read made with it go to
+// Metaname even if the Provider holds a cached listing of the zone, such as
+// after the zone has been changed elsewhere. The fresh listing then
+// replaces the cached one.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// zoneCacheKey identifies a zone in the cache however its name is written,
+// along with the endpoint a call made with ctx goes to, since the same zone
+// read from another endpoint is another listing.
+func (p *Provider) zoneCacheKey(ctx context.Context, zone string) string {
+	endpoint, _ := p.endpoint(ctx)
+	return endpoint + " " + strings.ToLower(strings.TrimRight(zone, "."))
+}
+
+// cachedRecords returns a copy of the cached listing of zone, if there is
+// one still fresh and ctx allows it. The caller must hold p.mutex.
+func (p *Provider) cachedRecords(ctx context.Context, zone string) ([]metanameRR, bool) {
+	if p.CacheTTL <= 0 || ctx.Value(noCacheKey{}) != nil {
+		return nil, false
+	}
+	cached, ok := p.cache[p.zoneCacheKey(ctx, zone)]
+	if !ok || time.Now().After(cached.expires) {
+		return nil, false
+	}
+	records := append([]metanameRR{}, cached.records...)
+	for i := range records {
+		records[i].fetched = cached.fetched
+	}
+	return records, true
+}
+
+// cacheRecords keeps a listing of zone, read from Metaname at fetched by a
+// call made with ctx, for CacheTTL. The caller must hold p.mutex.
+func (p *Provider) cacheRecords(ctx context.Context, zone string, records []metanameRR, fetched time.Time) {
+	if p.CacheTTL <= 0 {
+		return
+	}
+	if p.cache == nil {
+		p.cache = make(map[string]cachedZone)
+	}
+	p.cache[p.zoneCacheKey(ctx, zone)] = cachedZone{
+		records: append([]metanameRR{}, records...),
+		fetched: fetched,
+		expires: fetched.Add(p.CacheTTL),
+	}
+}
+
+// forgetRecords discards any cached listing of zone from the endpoint a
+// call made with ctx goes to, once the zone has been changed there, and
+// keeps any listing read meanwhile from being cached.
+func (p *Provider) forgetRecords(ctx context.Context, zone string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.cacheGeneration++
+	delete(p.cache, p.zoneCacheKey(ctx, zone))
+}
@@ -0,0 +1,132 @@
+package metaname
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestCacheAndBypass(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	p := f.provider()
+	p.CacheTTL = time.Hour
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := p.GetRecords(ctx, "example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := f.callCount("dns_zone"); n != 1 {
+		t.Fatalf("expected repeated reads to be answered from the cache; got %d dns_zone calls", n)
+	}
+
+	// A change made elsewhere is seen only by a read that bypasses the cache.
+	f.addRecord("example.com", map[string]interface{}{"name": "mail", "type": "A", "ttl": 300, "data": "192.0.2.2"})
+	records, err := p.GetRecords(WithoutCache(ctx), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || f.callCount("dns_zone") != 2 {
+		t.Fatalf("expected a fresh read with both records; got %d records and %d calls", len(records), f.callCount("dns_zone"))
+	}
+	if records, _ = p.GetRecords(ctx, "example.com"); len(records) != 2 || f.callCount("dns_zone") != 2 {
+		t.Fatalf("expected the fresh listing to be cached; got %d records and %d calls", len(records), f.callCount("dns_zone"))
+	}
+
+	// A change made through the Provider discards the cached listing.
+	if _, err := p.AppendRecords(ctx, "example.com", []libdns.Record{
+		{Name: "api", Type: "A", Value: "192.0.2.3", TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ = p.GetRecords(ctx, "example.com"); len(records) != 3 || f.callCount("dns_zone") != 3 {
+		t.Fatalf("expected a fresh read after a change; got %d records and %d calls", len(records), f.callCount("dns_zone"))
+	}
+}
+
+func TestCacheKeepsFetchTime(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	p := f.provider()
+	p.CacheTTL = time.Hour
+	ctx := context.Background()
+
+	if _, err := p.GetCustomRecords(ctx, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	fetched := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	cached := p.cache[p.zoneCacheKey(ctx, "example.com")]
+	cached.fetched = fetched
+	p.cache[p.zoneCacheKey(ctx, "example.com")] = cached
+
+	records, err := p.GetCustomRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := records[0].Metadata["fetched_at"]; got != "2026-01-02T03:04:05Z" {
+		t.Fatalf("expected a cached listing to report when it was fetched; got %q", got)
+	}
+	if n := f.callCount("dns_zone"); n != 1 {
+		t.Fatalf("expected the second read answered from the cache; got %d dns_zone calls", n)
+	}
+}
+
+func TestWritesBypassCache(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	old := f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	p := f.provider()
+	p.CacheTTL = time.Hour
+	ctx := context.Background()
+
+	if _, err := p.GetRecords(ctx, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	// Another client replaces the record while the listing is cached.
+	if _, err := f.provider().DeleteRecords(ctx, "example.com", []libdns.Record{{ID: old}}); err != nil {
+		t.Fatal(err)
+	}
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.2"})
+
+	if _, err := p.SetRecords(ctx, "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.3", TTL: 600 * time.Second},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	stored := f.records("example.com")
+	if len(stored) != 1 || stored[0]["data"] != "192.0.2.3" {
+		t.Fatalf("expected the current record updated in place; got %v", stored)
+	}
+}
+
+func TestCacheKeepsEndpointsApart(t *testing.T) {
+	first := newFakeMetaname(t, "example.com")
+	second := newFakeMetaname(t, "example.com")
+	second.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	p := first.provider()
+	p.CacheTTL = time.Hour
+	ctx := context.Background()
+	other := WithEndpoint(ctx, second.server.URL)
+
+	for i := 0; i < 2; i++ {
+		records, err := p.GetRecords(ctx, "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 0 {
+			t.Fatalf("expected the configured endpoint's empty zone; got %v", records)
+		}
+		if records, err = p.GetRecords(other, "example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 {
+			t.Fatalf("expected the overriding endpoint's zone; got %v", records)
+		}
+	}
+	if first.callCount("dns_zone") != 1 || second.callCount("dns_zone") != 1 {
+		t.Fatalf("expected each endpoint's listing cached separately; got %d and %d calls", first.callCount("dns_zone"), second.callCount("dns_zone"))
+	}
+}
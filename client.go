@@ -5,15 +5,41 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"time"
 )
 
+// rpcClient is the set of Metaname record operations the Provider is built
+// on. The Provider's own methods below implement it over HTTP; tests may
+// substitute another implementation.
+type rpcClient interface {
+	dns_zone(ctx context.Context, zone string) ([]metanameRR, error)
+	create_dns_record(ctx context.Context, zone string, record metanameRR) (string, error)
+	update_dns_record(ctx context.Context, zone string, reference string, record metanameRR) error
+	delete_dns_record(ctx context.Context, zone string, reference string) (bool, error)
+}
+
+// rpc returns the client that record operations go through.
+func (p *Provider) rpc() rpcClient {
+	if p.client != nil {
+		return p.client
+	}
+	return p
+}
+
 func (p *Provider) dns_zone(ctx context.Context, zone string) ([]metanameRR, error) {
 	p.mutex.Lock()
-	defer p.mutex.Unlock()
+	cached, ok := p.cachedRecords(ctx, zone)
+	generation := p.cacheGeneration
+	p.mutex.Unlock()
+	if ok {
+		return cached, nil
+	}
 
-	var records []metanameRR
+	records := []metanameRR{}
+	fetched := time.Now()
 
 	fqdn := strings.TrimRight(zone, ".")
 
@@ -24,11 +50,16 @@ func (p *Provider) dns_zone(ctx context.Context, zone string) ([]metanameRR, err
 	if err := p.makeRPCRequest(ctx, "dns_zone", params, &result); err != nil {
 		return nil, err
 	}
-	if result.Result == nil {
+	if isZoneNotFound(result.Error.Code, result.Error.Message) {
+		return nil, fmt.Errorf("%w: %s: %s", ErrZoneNotFound, fqdn, result.Error.Message)
+	}
+	if result.Error.Code != 0 {
 		return nil, fmt.Errorf("Metaname error: %s", result.Error.Message)
 	}
 
-	recs := result.Result.([]interface{})
+	// An empty zone may come back as a null result rather than an empty
+	// list; either way it holds no records.
+	recs, _ := result.Result.([]interface{})
 	for _, r := range recs {
 		rr := r.(map[string]interface{})
 		aux := -1
@@ -41,23 +72,34 @@ func (p *Provider) dns_zone(ctx context.Context, zone string) ([]metanameRR, err
 		if rr["ttl"] != nil {
 			ttl = int(rr["ttl"].(float64))
 		}
+		// The type is upper-cased, as everything here compares types that
+		// way, in case Metaname returns one in another case.
 		newRec := metanameRR{
 			Reference: rr["reference"].(string),
 			Name:      rr["name"].(string),
-			Type:      rr["type"].(string),
+			Type:      strings.ToUpper(rr["type"].(string)),
 			Aux:       aux,
 			Ttl:       ttl,
 			Data:      rr["data"].(string),
+			raw:       rr,
+			fetched:   fetched,
 		}
 		records = append(records, newRec)
 	}
 
+	p.mutex.Lock()
+	if p.cacheGeneration == generation {
+		p.cacheRecords(ctx, zone, records, fetched)
+	}
+	p.mutex.Unlock()
 	return records, nil
 }
 
 func (p *Provider) create_dns_record(ctx context.Context, zone string, record metanameRR) (string, error) {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
+	if err := p.checkWritable(zone); err != nil {
+		return "", err
+	}
+	defer p.forgetRecords(ctx, zone)
 
 	fqdn := strings.TrimRight(zone, ".")
 
@@ -74,8 +116,10 @@ func (p *Provider) create_dns_record(ctx context.Context, zone string, record me
 }
 
 func (p *Provider) update_dns_record(ctx context.Context, zone string, reference string, record metanameRR) error {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
+	if err := p.checkWritable(zone); err != nil {
+		return err
+	}
+	defer p.forgetRecords(ctx, zone)
 
 	fqdn := strings.TrimRight(zone, ".")
 
@@ -92,8 +136,10 @@ func (p *Provider) update_dns_record(ctx context.Context, zone string, reference
 }
 
 func (p *Provider) delete_dns_record(ctx context.Context, zone string, reference string) (bool, error) {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
+	if err := p.checkWritable(zone); err != nil {
+		return false, err
+	}
+	defer p.forgetRecords(ctx, zone)
 
 	fqdn := strings.TrimRight(zone, ".")
 
@@ -111,15 +157,110 @@ func (p *Provider) delete_dns_record(ctx context.Context, zone string, reference
 
 }
 
+func (p *Provider) account_balance(ctx context.Context) (float64, error) {
+	var result metanameResponse
+	if err := p.makeRPCRequest(ctx, "account_balance", nil, &result); err != nil {
+		return 0, err
+	}
+	if result.Result == nil {
+		return 0, fmt.Errorf("Metaname error from account_balance: %s", result.Error.Message)
+	}
+	balance, ok := result.Result.(float64)
+	if !ok {
+		return 0, fmt.Errorf("Metaname error from account_balance: unexpected result %v", result.Result)
+	}
+	return balance, nil
+}
+
+// domain_names lists the names of the domains in the account.
+func (p *Provider) domain_names(ctx context.Context) ([]string, error) {
+	var result metanameResponse
+	if err := p.makeRPCRequest(ctx, "domain_names", nil, &result); err != nil {
+		return nil, err
+	}
+	if result.Result == nil {
+		return nil, fmt.Errorf("Metaname error from domain_names: %s", result.Error.Message)
+	}
+	domains, ok := result.Result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Metaname error from domain_names: unexpected result %v", result.Result)
+	}
+	var names []string
+	for _, d := range domains {
+		switch d := d.(type) {
+		case string:
+			names = append(names, d)
+		case map[string]interface{}:
+			if name, ok := d["domain_name"].(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// endpointKey is the context key for a per-call endpoint override.
+type endpointKey struct{}
+
+// WithEndpoint returns a copy of ctx that directs any Provider call made
+// with it to endpoint instead of the Provider's configured Endpoint.
+func WithEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, endpoint)
+}
+
+// checkCredentials reports missing credentials before a request is made,
+// since Metaname's error for them doesn't say which is missing.
+func (p *Provider) checkCredentials() error {
+	if p.AccountReference == "" {
+		return fmt.Errorf("Metaname account reference required: AccountReference is empty")
+	}
+	if p.APIKey == "" {
+		return fmt.Errorf("Metaname API key required: APIKey is empty")
+	}
+	return nil
+}
+
+// environments maps the names accepted in Provider.Environment to their
+// API endpoints.
+var environments = map[string]string{
+	"production": "https://metaname.net/api/1.1",
+	"test":       "https://test.metaname.net/api/1.1",
+}
+
+// endpoint returns the API endpoint to use for a call made with ctx: an
+// override in ctx, else the Provider's Endpoint, else that of its
+// Environment, which defaults to production.
+func (p *Provider) endpoint(ctx context.Context) (string, error) {
+	if endpoint, ok := ctx.Value(endpointKey{}).(string); ok && endpoint != "" {
+		return endpoint, nil
+	}
+	if p.Endpoint != "" {
+		return p.Endpoint, nil
+	}
+	env := p.Environment
+	if env == "" {
+		env = "production"
+	}
+	endpoint, ok := environments[env]
+	if !ok {
+		return "", fmt.Errorf("unknown Metaname environment %q", p.Environment)
+	}
+	return endpoint, nil
+}
+
 func (p *Provider) makeRPCRequest(ctx context.Context, method string, params []interface{}, response *metanameResponse) error {
+	if err := p.checkCredentials(); err != nil {
+		return err
+	}
 	var req rpcRequest
 	req.Jsonrpc = "2.0"
 	req.Id = "abc"
 	req.Method = method
 	req.Params = append([]interface{}{p.AccountReference, p.APIKey}, params...)
 
-	if p.Endpoint == "" {
-		p.Endpoint = "https://metaname.net/api/1.1"
+	endpoint, err := p.endpoint(ctx)
+	if err != nil {
+		return err
 	}
 
 	raw, err := json.Marshal(req)
@@ -127,21 +268,169 @@ func (p *Provider) makeRPCRequest(ctx context.Context, method string, params []i
 		return err
 	}
 
-	hreq, err := http.NewRequestWithContext(ctx, "POST", p.Endpoint, bytes.NewReader(raw))
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		*response = metanameResponse{}
+		err := p.doRPCRequest(ctx, method, endpoint, raw, response)
+		transient := readOnlyMethods[method] && attempt < defaultReadRetries && isTransient(ctx, err, response)
+		if err == nil && !transient {
+			return nil
+		}
+		if !transient && (attempt >= p.MaxRetries || !isRetryable(ctx, method, err)) {
+			return err
+		}
+		delay := p.retryDelay(attempt, err)
+		if p.MaxRetryDuration > 0 && time.Since(start)+delay > p.MaxRetryDuration {
+			return err
+		}
+		if !takeRetry(ctx) {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// sendRPCRequest posts raw to endpoint and reads the whole response, whose
+// body is already closed when it is returned.
+func (p *Provider) sendRPCRequest(ctx context.Context, endpoint string, raw []byte) (*http.Response, []byte, error) {
+	hreq, err := p.newHTTPRequest(ctx, endpoint, raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating http request")
+	}
+
+	resp, err := p.requestClient().Do(hreq)
+	if err != nil {
+		return nil, nil, &transportError{err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, &transportError{err}
+	}
+	return resp, body, nil
+}
+
+// takeTurn waits until no other request to Metaname is in flight, so that
+// requests are made one at a time, or until ctx ends. Each attempt at a
+// request takes its own turn, so that a request waiting to be retried
+// doesn't hold up others. endTurn must be called once the response has been
+// read.
+func (p *Provider) takeTurn(ctx context.Context) error {
+	p.turnOnce.Do(func() { p.turn = make(chan struct{}, 1) })
+	select {
+	case p.turn <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// endTurn lets the next request to Metaname go ahead.
+func (p *Provider) endTurn() {
+	<-p.turn
+}
+
+// requestFormat describes how a JSON-RPC request is carried over HTTP, so
+// that a change to Metaname's API need only be made here.
+type requestFormat struct {
+	method      string
+	contentType string
+	// path is appended to the endpoint.
+	path string
+}
+
+// defaultRequestFormat is how Metaname's API takes requests today, and how
+// every request is made.
+var defaultRequestFormat = requestFormat{
+	method:      http.MethodPost,
+	contentType: "application/json",
+}
+
+// newHTTPRequest builds the HTTP request carrying the encoded JSON-RPC
+// request raw to endpoint, in defaultRequestFormat.
+func (p *Provider) newHTTPRequest(ctx context.Context, endpoint string, raw []byte) (*http.Request, error) {
+	format := defaultRequestFormat
+	hreq, err := http.NewRequestWithContext(ctx, format.method, endpoint+format.path, bytes.NewReader(raw))
 	if err != nil {
-		return fmt.Errorf("error creating http request")
+		return nil, err
 	}
-	hreq.Header.Set("Content-type", "application/json")
+	hreq.Header.Set("Content-Type", format.contentType)
+	return hreq, nil
+}
 
-	resp, err := http.DefaultClient.Do(hreq)
+// requestClient returns the HTTP client to make requests with.
+func (p *Provider) requestClient() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	if p.MaxIdleConns <= 0 && p.MaxConnsPerHost <= 0 {
+		return http.DefaultClient
+	}
+	p.httpOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if p.MaxIdleConns > 0 {
+			transport.MaxIdleConns = p.MaxIdleConns
+			transport.MaxIdleConnsPerHost = p.MaxIdleConns
+		}
+		transport.MaxConnsPerHost = p.MaxConnsPerHost
+		p.httpClient = &http.Client{Transport: transport}
+	})
+	return p.httpClient
+}
+
+// doRPCRequest performs a single attempt at an already-encoded request for
+// method.
+func (p *Provider) doRPCRequest(ctx context.Context, method, endpoint string, raw []byte, response *metanameResponse) error {
+	if err := p.takeTurn(ctx); err != nil {
+		return err
+	}
+	resp, body, err := p.sendRPCRequest(ctx, endpoint, raw)
+	p.endTurn()
 	if err != nil {
-		return fmt.Errorf("error performing http request")
+		return err
 	}
+	p.noteRateLimit(resp.Header)
 
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &rateLimitError{retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	if isAuthFailure(resp.StatusCode, "") {
+		return ErrUnauthorized
+	}
+	if isUnavailable(resp.StatusCode, "") {
+		return &unavailableError{retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+
+	if p.OnRawResponse != nil {
+		p.OnRawResponse(method, body)
+	}
+	responses, err := decodeRPCResponses(body)
+	if err != nil {
 		return fmt.Errorf("error decoding JSON: %s", err)
 	}
+	if len(responses) == 0 {
+		return fmt.Errorf("Metaname returned an empty response")
+	}
+	// Each request is sent on its own, so only one response is expected
+	// even when it comes wrapped in an array.
+	*response = responses[0]
 
-	return nil
+	if isRateLimitMessage(response.Error.Message) {
+		return &rateLimitError{retryAfter: retryAfterFromData(response.Error.Data)}
+	}
+	if response.Error.Code != 0 && isUnavailable(resp.StatusCode, response.Error.Message) {
+		return &unavailableError{retryAfter: retryAfterFromData(response.Error.Data), msg: response.Error.Message}
+	}
+	if response.Error.Code != 0 && isAuthFailure(resp.StatusCode, response.Error.Message) {
+		return fmt.Errorf("%w: %s", ErrUnauthorized, response.Error.Message)
+	}
 
+	return nil
 }
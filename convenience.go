@@ -0,0 +1,228 @@
+package metaname
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// AddTXTValue adds a single TXT record with value at name, leaving any other
+// TXT records at that name in place. This is AppendRecords for one TXT
+// value; use SetRecords instead to replace the TXT records at a name.
+func (p *Provider) AddTXTValue(ctx context.Context, zone, name, value string, ttl time.Duration) error {
+	_, err := p.AppendRecords(ctx, zone, []libdns.Record{
+		{Name: name, Type: "TXT", Value: value, TTL: ttl},
+	})
+	return err
+}
+
+// SetRecordsAndList sets records as SetRecords does, then lists the whole
+// zone as GetRecords does, so the caller sees the state the change left it
+// in rather than only the records it gave. If setting fails, nothing is
+// listed and the records set so far are returned with the error.
+func (p *Provider) SetRecordsAndList(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	if set, err := p.SetRecords(ctx, zone, records); err != nil {
+		return set, err
+	}
+	return p.GetRecords(ctx, zone)
+}
+
+// ReplaceRecord changes the one record in the zone matching old by name,
+// type, and value into replacement, updating it in place so it keeps its
+// reference. It fails if no record or more than one record matches old.
+// It returns the updated record.
+func (p *Provider) ReplaceRecord(ctx context.Context, zone string, old, replacement libdns.Record) (libdns.Record, error) {
+	if err := p.checkWritable(zone); err != nil {
+		return libdns.Record{}, err
+	}
+	if err := p.checkZone(ctx, zone); err != nil {
+		return libdns.Record{}, err
+	}
+	old = p.normalizeRecord(zone, old)
+	replacement = p.normalizeRecord(zone, replacement)
+	if err := validateRecord(replacement); err != nil {
+		return libdns.Record{}, err
+	}
+	existing, err := p.GetCustomRecords(WithoutCache(ctx), zone)
+	if err != nil {
+		return libdns.Record{}, err
+	}
+	var matches []CustomRecord
+	for _, cur := range existing {
+		if recordsMatch(cur.Record, old) {
+			matches = append(matches, cur)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return libdns.Record{}, fmt.Errorf("no %s %s (%q) in %s to replace", old.Type, displayName(old.Name), old.Value, zone)
+	case 1:
+	default:
+		return libdns.Record{}, fmt.Errorf("%d records match %s %s (%q) in %s; give the ID of the one to replace", len(matches), old.Type, displayName(old.Name), old.Value, zone)
+	}
+	cur := matches[0]
+	replacement = p.normalizeUpdate(zone, cur.stored, replacement)
+	replacement.ID = cur.ID
+	if err := p.rpc().update_dns_record(ctx, zone, cur.ID, overlayMetanameRR(cur.stored, replacement)); err != nil {
+		return libdns.Record{}, recordError("update", zone, cur.Record, err)
+	}
+	p.updated(zone, replacement, cur.ID)
+	return replacement, nil
+}
+
+// SetTTL changes the TTL of every record at name of type rtype to ttl,
+// leaving their values as they are, and returns how many records were
+// changed. Records already at ttl are left alone and not counted.
+func (p *Provider) SetTTL(ctx context.Context, zone, name, rtype string, ttl time.Duration) (int, error) {
+	if ttl < time.Second {
+		return 0, fmt.Errorf("invalid TTL %s: must be at least one second", ttl)
+	}
+	if err := p.checkWritable(zone); err != nil {
+		return 0, err
+	}
+	if err := p.checkZone(ctx, zone); err != nil {
+		return 0, err
+	}
+	existing, err := p.GetCustomRecords(WithoutCache(ctx), zone)
+	if err != nil {
+		return 0, err
+	}
+	if name == "@" {
+		name = ""
+	}
+	rtype = strings.ToUpper(rtype)
+	changed := 0
+	for _, cur := range existing {
+		if !namesMatch(cur.Name, name) || cur.Type != rtype || cur.TTL == ttl {
+			continue
+		}
+		update := overlayMetanameRR(cur.stored, libdns.Record{ID: cur.ID, TTL: ttl})
+		if err := p.rpc().update_dns_record(ctx, zone, cur.ID, update); err != nil {
+			return changed, recordError("update", zone, cur.Record, err)
+		}
+		changed++
+		updated := cur.Record
+		updated.TTL = ttl
+		p.updated(zone, updated, cur.ID)
+	}
+	return changed, nil
+}
+
+// RecordSpec is a plain description of a record, in the shape records are
+// often held in when migrating from elsewhere. TTL is in seconds.
+type RecordSpec struct {
+	Name  string
+	Type  string
+	Value string
+	TTL   int
+}
+
+// ImportRecords creates a record for each of specs, as AppendRecords does.
+// It returns the records that were added.
+func (p *Provider) ImportRecords(ctx context.Context, zone string, specs []RecordSpec) ([]libdns.Record, error) {
+	records := make([]libdns.Record, 0, len(specs))
+	for _, spec := range specs {
+		records = append(records, libdns.Record{
+			Name:  spec.Name,
+			Type:  strings.ToUpper(spec.Type),
+			Value: spec.Value,
+			TTL:   time.Duration(spec.TTL) * time.Second,
+		})
+	}
+	return p.AppendRecords(ctx, zone, records)
+}
+
+// DeleteRecordsByReference deletes the records with the given references,
+// returning the references that were deleted. A failure doesn't stop the
+// rest from being attempted; the error reports every reference that
+// couldn't be deleted. Requests go one at a time, as all requests from a
+// Provider do, and are retried according to MaxRetries.
+func (p *Provider) DeleteRecordsByReference(ctx context.Context, zone string, refs []string) ([]string, error) {
+	ctx = p.withRetryBudget(ctx)
+	if err := p.checkWritable(zone); err != nil {
+		return nil, err
+	}
+	if err := p.checkZone(ctx, zone); err != nil {
+		return nil, err
+	}
+	var deleted []string
+	var failed []string
+	for _, ref := range refs {
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+		ok, err := p.rpc().delete_dns_record(ctx, zone, ref)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%s)", ref, err))
+			continue
+		}
+		if ok {
+			deleted = append(deleted, ref)
+			p.deleted(zone, libdns.Record{ID: ref}, ref)
+		}
+	}
+	if len(failed) > 0 {
+		return deleted, fmt.Errorf("failed to delete %d of %d records in %s: %s", len(failed), len(refs), zone, strings.Join(failed, "; "))
+	}
+	return deleted, nil
+}
+
+// UpdateRecords updates each record whose reference is a key of updates to
+// the record it maps to, returning the updated records in reference order.
+// Fields the update leaves empty keep their current values, as they do for
+// SetRecords by ID. A failure doesn't stop the rest from being attempted;
+// the error reports every reference that couldn't be updated. Metaname has
+// no transactions, so the updates that succeed stay made either way.
+func (p *Provider) UpdateRecords(ctx context.Context, zone string, updates map[string]libdns.Record) ([]libdns.Record, error) {
+	ctx = p.withRetryBudget(ctx)
+	if err := p.checkWritable(zone); err != nil {
+		return nil, err
+	}
+	if err := p.checkZone(ctx, zone); err != nil {
+		return nil, err
+	}
+	refs := make([]string, 0, len(updates))
+	for ref, rec := range updates {
+		if err := validateRecord(p.normalizeRecord(zone, rec)); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	existing, err := p.GetCustomRecords(WithoutCache(ctx), zone)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]CustomRecord, len(existing))
+	for _, cur := range existing {
+		byID[cur.ID] = cur
+	}
+
+	var updated []libdns.Record
+	var failed []string
+	for _, ref := range refs {
+		if err := ctx.Err(); err != nil {
+			return updated, err
+		}
+		stored := metanameRR{Aux: -1}
+		if cur, ok := byID[ref]; ok {
+			stored = cur.stored
+		}
+		rec := p.normalizeUpdate(zone, stored, updates[ref])
+		rec.ID = ref
+		if err := p.rpc().update_dns_record(ctx, zone, ref, overlayMetanameRR(stored, rec)); err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%s)", ref, err))
+			continue
+		}
+		updated = append(updated, rec)
+		p.updated(zone, rec, ref)
+	}
+	if len(failed) > 0 {
+		return updated, fmt.Errorf("failed to update %d of %d records in %s: %s", len(failed), len(refs), zone, strings.Join(failed, "; "))
+	}
+	return updated, nil
+}
@@ -0,0 +1,207 @@
+package metaname
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestAddTXTValue(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "TXT", "ttl": 300, "data": "v=spf1 -all"})
+	p := f.provider()
+
+	if err := p.AddTXTValue(context.Background(), "example.com", "@", "google-site-verification=abc", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]bool{}
+	for _, rec := range f.records("example.com") {
+		if rec["name"] == "@" && rec["type"] == "TXT" {
+			values[rec["data"].(string)] = true
+		}
+	}
+	if len(values) != 2 || !values["v=spf1 -all"] || !values["google-site-verification=abc"] {
+		t.Fatalf("expected both TXT values to coexist; got %v", values)
+	}
+}
+
+func TestSetRecordsAndList(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "mail", "type": "A", "ttl": 300, "data": "192.0.2.9"})
+	p := f.provider()
+
+	zone, err := p.SetRecordsAndList(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.2", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(zone, fresh) {
+		t.Fatalf("expected the returned records to match a fresh listing; got %+v, want %+v", zone, fresh)
+	}
+	if len(zone) != 2 {
+		t.Fatalf("expected the whole zone of 2 records; got %+v", zone)
+	}
+}
+
+func TestReplaceRecord(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	ref := f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "dup", "type": "A", "ttl": 300, "data": "192.0.2.9"})
+	f.addRecord("example.com", map[string]interface{}{"name": "dup", "type": "A", "ttl": 600, "data": "192.0.2.9"})
+	p := f.provider()
+	ctx := context.Background()
+
+	rec, err := p.ReplaceRecord(ctx, "example.com",
+		libdns.Record{Name: "www", Type: "A", Value: "192.0.2.1"},
+		libdns.Record{Name: "www", Type: "A", Value: "192.0.2.2", TTL: 300 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.ID != ref || rec.Value != "192.0.2.2" {
+		t.Fatalf("expected the record to keep its reference with the new value; got %+v", rec)
+	}
+	for _, stored := range f.records("example.com") {
+		if stored["reference"] == ref && stored["data"] != "192.0.2.2" {
+			t.Fatalf("expected the stored record to be updated; got %v", stored)
+		}
+	}
+
+	if _, err := p.ReplaceRecord(ctx, "example.com",
+		libdns.Record{Name: "www", Type: "A", Value: "192.0.2.1"},
+		libdns.Record{Name: "www", Type: "A", Value: "192.0.2.3"}); err == nil {
+		t.Fatal("expected an error when no record matches")
+	}
+	if _, err := p.ReplaceRecord(ctx, "example.com",
+		libdns.Record{Name: "dup", Type: "A", Value: "192.0.2.9"},
+		libdns.Record{Name: "dup", Type: "A", Value: "192.0.2.10"}); err == nil {
+		t.Fatal("expected an error when several records match")
+	}
+}
+
+func TestSetTTL(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 3600, "data": "192.0.2.2"})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "TXT", "ttl": 300, "data": "other"})
+	p := f.provider()
+
+	n, err := p.SetTTL(context.Background(), "example.com", "www", "a", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 record changed; got %d", n)
+	}
+	records, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range records {
+		want := time.Hour
+		if rec.Type == "TXT" {
+			want = 300 * time.Second
+		}
+		if rec.TTL != want {
+			t.Fatalf("expected %s %s %s to have TTL %s; got %s", rec.Name, rec.Type, rec.Value, want, rec.TTL)
+		}
+		if rec.Type == "A" && rec.Value != "192.0.2.1" && rec.Value != "192.0.2.2" {
+			t.Fatalf("expected values to be left alone; got %s", rec.Value)
+		}
+	}
+}
+
+func TestImportRecords(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	added, err := p.ImportRecords(context.Background(), "example.com", []RecordSpec{
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300},
+		{Name: "www", Type: "aaaa", Value: "2001:db8::1", TTL: 300},
+		{Name: "alias", Type: "CNAME", Value: "www", TTL: 3600},
+		{Name: "", Type: "TXT", Value: "v=spf1 -all", TTL: 600},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 4 {
+		t.Fatalf("expected 4 records added; got %d", len(added))
+	}
+	if added[1].Type != "AAAA" || added[2].TTL != time.Hour {
+		t.Fatalf("unexpected converted records %+v", added)
+	}
+	stored := f.records("example.com")
+	if len(stored) != 4 {
+		t.Fatalf("expected 4 records stored; got %d", len(stored))
+	}
+	for _, rec := range stored {
+		if rec["type"] == "AAAA" && rec["ttl"] != float64(300) {
+			t.Fatalf("expected TTL of 300 seconds; got %v", rec["ttl"])
+		}
+	}
+}
+
+func TestDeleteRecordsByReference(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	ref1 := f.addRecord("example.com", map[string]interface{}{"name": "a", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	ref2 := f.addRecord("example.com", map[string]interface{}{"name": "b", "type": "A", "ttl": 300, "data": "192.0.2.2"})
+	keep := f.addRecord("example.com", map[string]interface{}{"name": "c", "type": "A", "ttl": 300, "data": "192.0.2.3"})
+	p := f.provider()
+
+	deleted, err := p.DeleteRecordsByReference(context.Background(), "example.com", []string{ref1, "nosuch", ref2})
+	if err == nil || !strings.Contains(err.Error(), "nosuch") {
+		t.Fatalf("expected error naming the missing reference; got %v", err)
+	}
+	if len(deleted) != 2 || deleted[0] != ref1 || deleted[1] != ref2 {
+		t.Fatalf("expected %s and %s deleted; got %v", ref1, ref2, deleted)
+	}
+	remaining := f.records("example.com")
+	if len(remaining) != 1 || remaining[0]["reference"] != keep {
+		t.Fatalf("expected only %s to remain; got %v", keep, remaining)
+	}
+}
+
+func TestUpdateRecords(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	www := f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	txt := f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "TXT", "ttl": 300, "data": "old"})
+	p := f.provider()
+
+	updated, err := p.UpdateRecords(context.Background(), "example.com", map[string]libdns.Record{
+		www: {Name: "www", Type: "A", Value: "192.0.2.2", TTL: 300 * time.Second},
+		txt: {Value: "new"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated) != 2 {
+		t.Fatalf("expected 2 records updated; got %+v", updated)
+	}
+	byRef := map[string]string{}
+	for _, rec := range f.records("example.com") {
+		byRef[rec["reference"].(string)] = rec["data"].(string)
+	}
+	if byRef[www] != "192.0.2.2" || byRef[txt] != "new" {
+		t.Fatalf("expected both records changed; got %v", byRef)
+	}
+
+	updated, err = p.UpdateRecords(context.Background(), "example.com", map[string]libdns.Record{
+		www:       {Value: "192.0.2.3"},
+		"nosuch1": {Name: "x", Type: "A", Value: "192.0.2.4"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "nosuch1") {
+		t.Fatalf("expected an error naming the failed reference; got %v", err)
+	}
+	if len(updated) != 1 || updated[0].ID != www {
+		t.Fatalf("expected the other update to go ahead; got %+v", updated)
+	}
+}
@@ -0,0 +1,72 @@
+package metaname
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrUnauthorized is returned, possibly wrapped, when Metaname rejects the
+// account reference or API key.
+var ErrUnauthorized = errors.New("Metaname rejected the account reference or API key")
+
+// ErrTemporarilyUnavailable is returned, possibly wrapped, when Metaname is
+// down for maintenance or otherwise unable to serve requests for now. Such
+// requests are retried according to MaxRetries.
+var ErrTemporarilyUnavailable = errors.New("Metaname is temporarily unavailable")
+
+// ErrReadOnly is returned, wrapped, when a Provider with ReadOnly set is
+// asked to change a zone.
+var ErrReadOnly = errors.New("provider is read-only")
+
+// ErrZoneNotFound is returned, wrapped, when Metaname has no such zone. A
+// zone that exists but holds no records gives an empty list instead.
+var ErrZoneNotFound = errors.New("zone not found")
+
+// ErrZoneNotOwned is returned, wrapped, when CheckZoneOwnership is set and a
+// zone to be changed isn't one of the account's domains.
+var ErrZoneNotOwned = errors.New("zone does not belong to the Metaname account")
+
+// ErrRecordChanged is returned, wrapped, when ConditionalUpdates is set and a
+// record to be updated has changed since the zone was read.
+var ErrRecordChanged = errors.New("record changed since it was read")
+
+// isAuthFailure reports whether an HTTP status or JSON-RPC error message
+// indicates that the credentials were rejected.
+func isAuthFailure(status int, msg string) bool {
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		return true
+	}
+	msg = strings.ToLower(msg)
+	for _, s := range []string{"api key", "account reference", "authenticat", "unauthori", "credential"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnavailable reports whether an HTTP status or JSON-RPC error message
+// indicates that Metaname is temporarily unable to serve requests.
+func isUnavailable(status int, msg string) bool {
+	if status == http.StatusServiceUnavailable {
+		return true
+	}
+	msg = strings.ToLower(msg)
+	for _, s := range []string{"maintenance", "temporarily unavailable", "service unavailable", "try again later"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// rpcNoSuchZone is the JSON-RPC error code Metaname gives for a zone it
+// doesn't host.
+const rpcNoSuchZone = -4
+
+// isZoneNotFound reports whether a JSON-RPC error says the zone doesn't
+// exist.
+func isZoneNotFound(code int, msg string) bool {
+	return code == rpcNoSuchZone || strings.Contains(strings.ToLower(msg), "no such zone")
+}
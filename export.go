@@ -0,0 +1,93 @@
+package metaname
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// exportFormat identifies the layout ExportJSON writes, so that ImportJSON
+// can refuse a layout it doesn't know.
+const exportFormat = "metaname-records/1"
+
+// zoneExport is the document ExportJSON writes and ImportJSON reads.
+type zoneExport struct {
+	Format  string         `json:"format"`
+	Zone    string         `json:"zone"`
+	Records []recordExport `json:"records"`
+}
+
+// recordExport is one record of a zoneExport. TTL is in seconds.
+type recordExport struct {
+	Reference string            `json:"reference"`
+	Name      string            `json:"name"`
+	Type      string            `json:"type"`
+	Value     string            `json:"value"`
+	TTL       int               `json:"ttl"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// ExportJSON returns every record in the zone, with its reference and the
+// metadata GetCustomRecords gives it, as an indented JSON document. Records
+// are in the order GetCustomRecords lists them and the "fetched_at"
+// metadata is left out, so exporting an unchanged zone twice gives the same
+// bytes. ImportJSON reads the document back.
+func (p *Provider) ExportJSON(ctx context.Context, zone string) ([]byte, error) {
+	records, err := p.GetCustomRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	doc := zoneExport{Format: exportFormat, Zone: zone, Records: []recordExport{}}
+	for _, rec := range records {
+		metadata := make(map[string]string, len(rec.Metadata))
+		for k, v := range rec.Metadata {
+			if k != "fetched_at" {
+				metadata[k] = v
+			}
+		}
+		doc.Records = append(doc.Records, recordExport{
+			Reference: rec.ID,
+			Name:      rec.Name,
+			Type:      rec.Type,
+			Value:     rec.Value,
+			TTL:       ttlSeconds(rec.TTL),
+			Metadata:  metadata,
+		})
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// ImportJSON reads a document written by ExportJSON and adds its records
+// to the zone as AppendRecords does, returning the records added. Metaname
+// assigns the new records fresh references, so the exported ones aren't
+// kept. Records Metaname manages itself and forwarding entries are skipped,
+// as recorded in their metadata, and nothing is added if the document can't
+// be read.
+func (p *Provider) ImportJSON(ctx context.Context, zone string, data []byte) ([]libdns.Record, error) {
+	var doc zoneExport
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid record export: %w", err)
+	}
+	if doc.Format != exportFormat {
+		return nil, fmt.Errorf("invalid record export: unknown format %q", doc.Format)
+	}
+	var records []libdns.Record
+	for _, rec := range doc.Records {
+		if rec.Metadata["origin"] == "system" {
+			continue
+		}
+		if _, ok := rec.Metadata["forwarding"]; ok {
+			continue
+		}
+		records = append(records, libdns.Record{
+			Name:  rec.Name,
+			Type:  rec.Type,
+			Value: rec.Value,
+			TTL:   time.Duration(rec.TTL) * time.Second,
+		})
+	}
+	return p.AppendRecords(ctx, zone, records)
+}
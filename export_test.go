@@ -0,0 +1,73 @@
+package metaname
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestExportJSONRoundTrip(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "NS", "ttl": 86400, "data": "ns1.metaname.net."})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "_dmarc", "type": "TXT", "ttl": 3600, "data": `v=DMARC1; p=none; note "quoted"`})
+	f.addRecord("example.com", map[string]interface{}{"name": "alias", "type": "CNAME", "ttl": 600, "data": "www.example.com."})
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "MX", "ttl": 3600, "aux": 10, "data": "mail.example.com."})
+	p := f.provider()
+
+	exported, err := p.ExportJSON(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := p.ExportJSON(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(exported, again) {
+		t.Fatalf("expected exports of an unchanged zone to match; got %s and %s", exported, again)
+	}
+	for _, want := range []string{`"reference": "ref2"`, `"aux": "10"`, `"origin": "system"`} {
+		if !bytes.Contains(exported, []byte(want)) {
+			t.Fatalf("expected %s in the export; got %s", want, exported)
+		}
+	}
+
+	fresh := newFakeMetaname(t, "example.com")
+	fp := fresh.provider()
+	added, err := fp.ImportJSON(context.Background(), "example.com", exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 4 {
+		t.Fatalf("expected 4 records added, leaving out the apex NS; got %+v", added)
+	}
+
+	want, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fp.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantUser := want[:0]
+	for _, rec := range want {
+		if rec.Type != "NS" {
+			rec.ID = ""
+			wantUser = append(wantUser, rec)
+		}
+	}
+	if len(got) != len(wantUser) {
+		t.Fatalf("expected %d records imported; got %+v", len(wantUser), got)
+	}
+	for i := range wantUser {
+		got[i].ID = ""
+		if got[i] != wantUser[i] {
+			t.Fatalf("expected %+v to round-trip; got %+v", wantUser[i], got[i])
+		}
+	}
+
+	if _, err := fp.ImportJSON(context.Background(), "example.com", []byte(`{"format":"other","records":[]}`)); err == nil {
+		t.Fatal("expected an error importing an unknown format")
+	}
+}
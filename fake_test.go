@@ -0,0 +1,290 @@
+package metaname
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeMetaname is an in-process stand-in for the Metaname JSON-RPC API,
+// holding zones in memory so provider logic can be tested without the live
+// test endpoint.
+type fakeMetaname struct {
+	mu      sync.Mutex
+	server  *httptest.Server
+	zones   map[string][]map[string]interface{}
+	nextRef int
+	calls   []string
+
+	// intercept, when set, is consulted before normal handling. If it
+	// returns true it has written the response itself.
+	intercept func(w http.ResponseWriter, method string, params []json.RawMessage) bool
+}
+
+// newFakeMetaname starts a fake server holding an empty zone named zone.
+func newFakeMetaname(t *testing.T, zone string) *fakeMetaname {
+	f := &fakeMetaname{zones: map[string][]map[string]interface{}{zone: {}}}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// provider returns a Provider configured to talk to the fake server.
+func (f *fakeMetaname) provider() *Provider {
+	return &Provider{
+		APIKey:           "key",
+		AccountReference: "ab12",
+		Endpoint:         f.server.URL,
+	}
+}
+
+// addRecord stores a raw record directly in the zone, bypassing the API,
+// and returns its reference.
+func (f *fakeMetaname) addRecord(zone string, rec map[string]interface{}) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ref := f.newReference()
+	rec["reference"] = ref
+	f.zones[zone] = append(f.zones[zone], rec)
+	return ref
+}
+
+// setField changes one field of a stored record directly, bypassing the
+// API, as another client's change would.
+func (f *fakeMetaname) setField(zone, ref, field string, value interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, rec := range f.zones[zone] {
+		if rec["reference"] == ref {
+			rec[field] = value
+		}
+	}
+}
+
+// records returns a copy of the raw records currently stored in zone.
+func (f *fakeMetaname) records(zone string) []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []map[string]interface{}
+	for _, rec := range f.zones[zone] {
+		cp := map[string]interface{}{}
+		for k, v := range rec {
+			cp[k] = v
+		}
+		out = append(out, cp)
+	}
+	return out
+}
+
+// callCount returns how many requests for method have been received.
+func (f *fakeMetaname) callCount(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		if c == method {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeMetaname) newReference() string {
+	f.nextRef++
+	return "ref" + strconv.Itoa(f.nextRef)
+}
+
+func (f *fakeMetaname) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeRPCError(w, -32700, "Parse error")
+		return
+	}
+	f.mu.Lock()
+	f.calls = append(f.calls, req.Method)
+	intercept := f.intercept
+	f.mu.Unlock()
+	if intercept != nil && intercept(w, req.Method, req.Params) {
+		return
+	}
+	if len(req.Params) < 2 {
+		writeRPCError(w, -32602, "Invalid params")
+		return
+	}
+	var accountReference, apiKey string
+	json.Unmarshal(req.Params[0], &accountReference)
+	json.Unmarshal(req.Params[1], &apiKey)
+	if accountReference != "ab12" || apiKey != "key" {
+		writeRPCError(w, -1, "Invalid account reference or API key")
+		return
+	}
+	params := req.Params[2:]
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch req.Method {
+	case "account_balance":
+		writeRPCResult(w, 42.5)
+		return
+	case "domain_names":
+		domains := []map[string]interface{}{}
+		for zone := range f.zones {
+			domains = append(domains, map[string]interface{}{"domain_name": zone})
+		}
+		writeRPCResult(w, domains)
+		return
+	}
+	var zone string
+	if len(params) > 0 {
+		json.Unmarshal(params[0], &zone)
+	}
+	records, ok := f.zones[zone]
+	if !ok {
+		writeRPCError(w, -4, "No such zone")
+		return
+	}
+	switch req.Method {
+	case "dns_zone":
+		if records == nil {
+			records = []map[string]interface{}{}
+		}
+		writeRPCResult(w, records)
+	case "create_dns_record":
+		var rec map[string]interface{}
+		if len(params) < 2 || json.Unmarshal(params[1], &rec) != nil || rec["type"] == nil || rec["data"] == nil {
+			writeRPCError(w, -32602, "Invalid record")
+			return
+		}
+		ref := f.newReference()
+		rec["reference"] = ref
+		f.zones[zone] = append(records, rec)
+		f.bumpSerial(zone)
+		writeRPCResult(w, ref)
+	case "update_dns_record":
+		var ref string
+		var rec map[string]interface{}
+		if len(params) < 3 || json.Unmarshal(params[1], &ref) != nil || json.Unmarshal(params[2], &rec) != nil {
+			writeRPCError(w, -32602, "Invalid params")
+			return
+		}
+		for i, cur := range records {
+			if cur["reference"] == ref {
+				rec["reference"] = ref
+				records[i] = rec
+				f.bumpSerial(zone)
+				writeRPCResult(w, nil)
+				return
+			}
+		}
+		writeRPCError(w, -5, "No such record")
+	case "delete_dns_record":
+		var ref string
+		if len(params) < 2 || json.Unmarshal(params[1], &ref) != nil {
+			writeRPCError(w, -32602, "Invalid params")
+			return
+		}
+		for i, cur := range records {
+			if cur["reference"] == ref {
+				f.zones[zone] = append(records[:i:i], records[i+1:]...)
+				f.bumpSerial(zone)
+				writeRPCResult(w, true)
+				return
+			}
+		}
+		writeRPCError(w, -5, "No such record")
+	default:
+		writeRPCError(w, -32601, "Method not found")
+	}
+}
+
+// bumpSerial increases the serial of the zone's SOA record, if it has one,
+// as Metaname does when a zone changes. The caller must hold f.mu.
+func (f *fakeMetaname) bumpSerial(zone string) {
+	for _, rec := range f.zones[zone] {
+		if rec["type"] != "SOA" {
+			continue
+		}
+		fields := strings.Fields(rec["data"].(string))
+		if serial, err := strconv.Atoi(fields[2]); err == nil {
+			fields[2] = strconv.Itoa(serial + 1)
+			rec["data"] = strings.Join(fields, " ")
+		}
+	}
+}
+
+func writeRPCResult(w http.ResponseWriter, result interface{}) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      "abc",
+		"result":  result,
+	})
+}
+
+func writeRPCError(w http.ResponseWriter, code int, message string) {
+	writeRPCErrorData(w, code, message, nil)
+}
+
+func writeRPCErrorData(w http.ResponseWriter, code int, message string, data interface{}) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      "abc",
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"data":    data,
+		},
+	})
+}
+
+// memoryRPC is an rpcClient holding a single zone's records in memory, for
+// testing record logic without any HTTP at all.
+type memoryRPC struct {
+	records []metanameRR
+	nextRef int
+	ops     []string
+}
+
+func (m *memoryRPC) dns_zone(ctx context.Context, zone string) ([]metanameRR, error) {
+	m.ops = append(m.ops, "dns_zone")
+	return append([]metanameRR(nil), m.records...), nil
+}
+
+func (m *memoryRPC) create_dns_record(ctx context.Context, zone string, record metanameRR) (string, error) {
+	m.ops = append(m.ops, "create "+record.Data)
+	m.nextRef++
+	record.Reference = "mem" + strconv.Itoa(m.nextRef)
+	m.records = append(m.records, record)
+	return record.Reference, nil
+}
+
+func (m *memoryRPC) update_dns_record(ctx context.Context, zone string, reference string, record metanameRR) error {
+	m.ops = append(m.ops, "update "+record.Data)
+	for i, cur := range m.records {
+		if cur.Reference == reference {
+			record.Reference = reference
+			m.records[i] = record
+			return nil
+		}
+	}
+	return fmt.Errorf("no such record %s", reference)
+}
+
+func (m *memoryRPC) delete_dns_record(ctx context.Context, zone string, reference string) (bool, error) {
+	m.ops = append(m.ops, "delete "+reference)
+	for i, cur := range m.records {
+		if cur.Reference == reference {
+			m.records = append(m.records[:i:i], m.records[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,26 @@
+package metaname
+
+import "github.com/libdns/libdns"
+
+// RecordHook is called after a record is successfully changed, with the
+// zone, the record as written (or, for a deletion, as it was), and its
+// reference.
+type RecordHook func(zone string, rec libdns.Record, ref string)
+
+func (p *Provider) created(zone string, rec libdns.Record, ref string) {
+	if p.OnCreate != nil {
+		p.OnCreate(zone, rec, ref)
+	}
+}
+
+func (p *Provider) updated(zone string, rec libdns.Record, ref string) {
+	if p.OnUpdate != nil {
+		p.OnUpdate(zone, rec, ref)
+	}
+}
+
+func (p *Provider) deleted(zone string, rec libdns.Record, ref string) {
+	if p.OnDelete != nil {
+		p.OnDelete(zone, rec, ref)
+	}
+}
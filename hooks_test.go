@@ -0,0 +1,121 @@
+package metaname
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestRecordHooks(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+	var events []string
+	hook := func(event string) RecordHook {
+		return func(zone string, rec libdns.Record, ref string) {
+			if zone != "example.com" || rec.ID != ref {
+				t.Fatalf("unexpected %s hook arguments %s %+v %s", event, zone, rec, ref)
+			}
+			events = append(events, event+" "+rec.Name+" "+rec.Value+" "+ref)
+		}
+	}
+	p.OnCreate = hook("create")
+	p.OnUpdate = hook("update")
+	p.OnDelete = hook("delete")
+	ctx := context.Background()
+
+	added, err := p.AppendRecords(ctx, "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := added[0].ID
+	if _, err := p.SetRecords(ctx, "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.2", TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DeleteRecords(ctx, "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.2"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"create www 192.0.2.1 " + ref,
+		"update www 192.0.2.2 " + ref,
+		"delete www 192.0.2.2 " + ref,
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected hooks %v; got %v", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("expected hooks %v; got %v", want, events)
+		}
+	}
+}
+
+func TestOnRawResponse(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	p := f.provider()
+
+	// Unset, it's simply not called.
+	if _, err := p.GetRecords(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	var methods []string
+	var bodies [][]byte
+	p.OnRawResponse = func(method string, raw []byte) {
+		methods = append(methods, method)
+		bodies = append(bodies, raw)
+	}
+	if _, err := p.GetRecords(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if len(methods) != 1 || methods[0] != "dns_zone" {
+		t.Fatalf("expected one dns_zone response; got %v", methods)
+	}
+	var response struct {
+		Result []map[string]interface{} `json:"result"`
+	}
+	if err := json.Unmarshal(bodies[0], &response); err != nil {
+		t.Fatalf("expected the raw JSON body; got %q: %v", bodies[0], err)
+	}
+	if len(response.Result) != 1 || response.Result[0]["data"] != "192.0.2.1" {
+		t.Fatalf("expected the body to hold the record as Metaname sent it; got %s", bodies[0])
+	}
+}
+
+func TestOnRawResponseMayUseProvider(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+	var usageErr error
+	p.OnRawResponse = func(method string, raw []byte) {
+		if method == "dns_zone" {
+			_, usageErr = p.Usage(context.Background())
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.GetRecords(context.Background(), "example.com")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a hook using the Provider not to deadlock")
+	}
+	if usageErr != nil {
+		t.Fatalf("expected the hook's call to Usage to succeed; got %v", usageErr)
+	}
+}
@@ -0,0 +1,79 @@
+package metaname
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// recordMetadata collects the details of mrec, read from zone, that don't
+// fit in a libdns.Record:
+//
+//   - "origin" is "system" for records Metaname manages itself (see
+//     isSystemRecord) and "user" for all others.
+//   - "forwarding" names the kind of forwarding for the forwarding entries
+//     Metaname lists alongside DNS records.
+//   - "aux" is the MX preference or SRV priority, which Metaname holds
+//     apart from the rest of the data, for records of those types.
+//   - "glue" is "true" for A and AAAA records that give the address of a
+//     nameserver named by an NS record in the zone; see markGlue.
+//   - "version" identifies the record's current content, changing
+//     whenever any of its fields does; see recordVersion.
+//   - "fetched_at" is when the record was read from Metaname, in RFC 3339
+//     format, from which with the TTL a cached copy's expiry can be worked
+//     out. A listing answered from the zone cache keeps the time it was
+//     first read. It is set by GetCustomRecords.
+func recordMetadata(mrec metanameRR, zone string) map[string]string {
+	metadata := map[string]string{"origin": "user"}
+	if isSystemRecord(mrec, zone) {
+		metadata["origin"] = "system"
+	}
+	metadata["version"] = recordVersion(mrec)
+	if _, ok := auxFields[mrec.Type]; ok && mrec.Aux >= 0 {
+		metadata["aux"] = strconv.Itoa(mrec.Aux)
+	}
+	if kind, ok := forwardingTypes[mrec.Type]; ok {
+		metadata["forwarding"] = kind
+	}
+	return metadata
+}
+
+// recordVersion derives a version for mrec from its content, since
+// Metaname keeps no version or modification counter of its own, and
+// reports no creation or modification times either. Two reads
+// of a record give the same version only if nothing about it changed in
+// between.
+func recordVersion(mrec metanameRR) string {
+	raw, _ := json.Marshal(mrec.raw)
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%d\x00%d\x00%s\x00%s", mrec.Reference, mrec.Name, mrec.Type, mrec.Aux, mrec.Ttl, mrec.Data, raw)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// markGlue sets "glue" metadata on the A and AAAA records in records that
+// give addresses for in-zone nameserver hostnames, since those records hold
+// up delegations and need care when changed. Metaname stores glue as
+// ordinary address records, so it can be read and written like any other.
+func markGlue(records []CustomRecord, zone string) {
+	nameservers := make(map[string]bool)
+	for _, rec := range records {
+		if rec.Type != "NS" {
+			continue
+		}
+		target := rec.Value
+		if strings.HasSuffix(target, ".") {
+			target = relativeName(target, zone)
+			if strings.HasSuffix(target, ".") {
+				continue // outside the zone
+			}
+		}
+		nameservers[strings.ToLower(target)] = true
+	}
+	for _, rec := range records {
+		if (rec.Type == "A" || rec.Type == "AAAA") && nameservers[strings.ToLower(rec.Name)] {
+			rec.Metadata["glue"] = "true"
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package metaname
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGlueMetadata(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "sub", "type": "NS", "ttl": 3600, "data": "ns1.sub.example.com."})
+	f.addRecord("example.com", map[string]interface{}{"name": "sub", "type": "NS", "ttl": 3600, "data": "ns.example.net."})
+	f.addRecord("example.com", map[string]interface{}{"name": "ns1.sub", "type": "A", "ttl": 3600, "data": "192.0.2.53"})
+	f.addRecord("example.com", map[string]interface{}{"name": "ns1.sub", "type": "AAAA", "ttl": 3600, "data": "2001:db8::53"})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	p := f.provider()
+
+	records, err := p.GetCustomRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	glue := 0
+	for _, rec := range records {
+		if rec.Metadata["glue"] == "true" {
+			glue++
+			if rec.Name != "ns1.sub" {
+				t.Fatalf("expected only the nameserver's addresses to be glue; got %s %s", rec.Name, rec.Type)
+			}
+		}
+	}
+	if glue != 2 {
+		t.Fatalf("expected 2 glue records; got %d", glue)
+	}
+}
+
+func TestFetchedAtMetadata(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	p := f.provider()
+
+	before := time.Now().Add(-time.Second)
+	records, err := p.GetCustomRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetched, err := time.Parse(time.RFC3339, records[0].Metadata["fetched_at"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched.Before(before) || fetched.After(time.Now()) {
+		t.Fatalf("expected fetched_at to be the time of the listing; got %s", fetched)
+	}
+}
+
+func TestAuxMetadata(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "MX", "aux": 10, "ttl": 3600, "data": "mail.example.com."})
+	f.addRecord("example.com", map[string]interface{}{"name": "_sip._tcp", "type": "SRV", "aux": 0, "ttl": 3600, "data": "20 5060 sip.example.com."})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "aux": nil, "ttl": 300, "data": "192.0.2.1"})
+	p := f.provider()
+
+	mrecs, err := p.dns_zone(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	aux := make(map[string]int)
+	for _, mrec := range mrecs {
+		aux[mrec.Type] = mrec.Aux
+	}
+	if aux["MX"] != 10 || aux["SRV"] != 0 || aux["A"] != -1 {
+		t.Fatalf("expected aux to be read as 10, 0, and -1; got %v", aux)
+	}
+
+	records, err := p.GetCustomRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range records {
+		want, ok := map[string]string{"MX": "10", "SRV": "0"}[rec.Type]
+		if got, has := rec.Metadata["aux"]; got != want || has != ok {
+			t.Fatalf("%s: expected aux metadata %q; got %q", rec.Type, want, got)
+		}
+	}
+}
@@ -1,12 +1,185 @@
 package metaname
 
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
 type metanameRR struct {
 	Reference string `json:"reference,omitempty"`
 	Name      string `json:"name,omitempty"`
 	Type      string `json:"type,omitempty"`
-	Aux       int    `json:"aux,omitempty"`
-	Ttl       int    `json:"ttl,omitempty"`
-	Data      string `json:"data,omitempty"`
+	// Aux is the MX preference or SRV priority, or -1 when the record has
+	// neither.
+	Aux  int    `json:"aux,omitempty"`
+	Ttl  int    `json:"ttl,omitempty"`
+	Data string `json:"data,omitempty"`
+
+	// raw holds the record exactly as dns_zone returned it, for fields
+	// that aren't modelled above.
+	raw map[string]interface{}
+	// fetched is when dns_zone read the record from Metaname, which for a
+	// listing answered from the cache is when the cached listing was read.
+	fetched time.Time
+}
+
+// toMetanameRR converts rec to the form Metaname's API takes. Metaname
+// names the zone apex "@"; a record with neither name nor type is a partial
+// update by ID, so its empty name is left alone.
+//
+// Metaname holds an MX record's preference, and an SRV record's priority,
+// in aux, apart from the rest of the data. An MX value written as
+// "<preference> <target>" is split between the two, as is an SRV value
+// written as "<priority> <weight> <port> <target>", leaving
+// "<weight> <port> <target>" in data.
+func toMetanameRR(rec libdns.Record) metanameRR {
+	name := rec.Name
+	if name == "" && rec.Type != "" {
+		name = "@"
+	}
+	mrec := metanameRR{
+		Name: name,
+		Type: rec.Type,
+		Aux:  -1,
+		Ttl:  ttlSeconds(rec.TTL),
+		Data: rec.Value,
+	}
+	if fields, ok := auxFields[rec.Type]; ok {
+		if aux, rest, ok := splitAux(rec.Value, fields); ok {
+			mrec.Aux = aux
+			mrec.Data = rest
+		}
+	}
+	return mrec
+}
+
+// ttlSeconds converts ttl to the whole seconds Metaname works in, rounding
+// any fraction of a second up, so that a TTL under a second becomes 1
+// rather than the zero that would mean no TTL at all. A zero TTL stays zero.
+func ttlSeconds(ttl time.Duration) int {
+	return int((ttl + time.Second - 1) / time.Second)
+}
+
+// fromMetanameRR converts a record read from Metaname's listing of zone to
+// a libdns record, reversing toMetanameRR: the name is made relative to the
+// zone, with "" for the apex, and any aux is put back at the front of the
+// value.
+func fromMetanameRR(mrec metanameRR, zone string) libdns.Record {
+	return libdns.Record{
+		ID:    mrec.Reference,
+		Type:  mrec.Type,
+		Name:  relativeName(mrec.Name, zone),
+		TTL:   time.Duration(mrec.Ttl) * time.Second,
+		Value: recordValue(mrec),
+	}
+}
+
+// auxFields gives, for each type whose leading field Metaname holds in aux,
+// how many fields its full value has.
+var auxFields = map[string]int{
+	"MX":  2,
+	"SRV": 4,
+}
+
+// recordValue returns the libdns value of a record read from Metaname,
+// putting an MX preference or SRV priority back at the front. Hostname
+// targets are given in presentation format, escaped as escapeTarget does,
+// whether or not Metaname returned them escaped, and without any stray
+// whitespace around them.
+func recordValue(mrec metanameRR) string {
+	data := mrec.Data
+	switch mrec.Type {
+	case "CNAME", "MX", "NS", "PTR":
+		data = escapeTarget(strings.TrimSpace(data))
+	}
+	if _, ok := auxFields[mrec.Type]; ok && mrec.Aux >= 0 {
+		return strconv.Itoa(mrec.Aux) + " " + data
+	}
+	return data
+}
+
+// splitAux splits a value of n fields into its leading number, a 16-bit MX
+// preference or SRV priority, and the rest. Zero is a valid leading number,
+// as in the null MX "0 .".
+func splitAux(value string, n int) (int, string, bool) {
+	fields := strings.Fields(value)
+	if len(fields) != n {
+		return 0, "", false
+	}
+	aux, err := strconv.Atoi(fields[0])
+	if err != nil || aux < 0 || aux > 65535 {
+		return 0, "", false
+	}
+	return aux, strings.Join(fields[1:], " "), true
+}
+
+// overlayMetanameRR lays the fields rec gives over stored, the record as it
+// is currently held by Metaname, so that an update leaves anything rec
+// doesn't describe as it was. A record with neither name nor type is a
+// partial update that changes only its value and, if given, its TTL; the
+// value is read as one of the stored record's type, so an MX preference or
+// SRV priority given with it goes to aux as toMetanameRR would put it.
+func overlayMetanameRR(stored metanameRR, rec libdns.Record) metanameRR {
+	merged := stored
+	merged.Reference = ""
+	if rec.Name == "" && rec.Type == "" {
+		if rec.Value != "" {
+			update := toMetanameRR(libdns.Record{Type: stored.Type, Value: rec.Value})
+			merged.Data = update.Data
+			if update.Aux >= 0 {
+				merged.Aux = update.Aux
+			}
+		}
+		if rec.TTL > 0 {
+			merged.Ttl = ttlSeconds(rec.TTL)
+		}
+		return merged
+	}
+	update := toMetanameRR(rec)
+	merged.Name = update.Name
+	merged.Type = update.Type
+	merged.Ttl = update.Ttl
+	merged.Data = update.Data
+	if update.Aux >= 0 {
+		merged.Aux = update.Aux
+	}
+	return merged
+}
+
+// MarshalJSON encodes r for Metaname. A record read from dns_zone is
+// encoded starting from its raw fields, so that anything this package
+// doesn't model is sent back unchanged rather than cleared; the modelled
+// fields are then set over them wherever they are non-empty.
+func (r metanameRR) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]interface{}, len(r.raw)+6)
+	for k, v := range r.raw {
+		fields[k] = v
+	}
+	delete(fields, "reference")
+	if r.Reference != "" {
+		fields["reference"] = r.Reference
+	}
+	if r.Name != "" {
+		fields["name"] = r.Name
+	}
+	if r.Type != "" {
+		fields["type"] = r.Type
+	}
+	if r.Aux >= 0 {
+		fields["aux"] = r.Aux
+	}
+	if r.Ttl != 0 {
+		fields["ttl"] = r.Ttl
+	}
+	if r.Data != "" {
+		fields["data"] = r.Data
+	}
+	return json.Marshal(fields)
 }
 
 type rpcRequest struct {
@@ -23,6 +196,25 @@ type metanameResponse struct {
 	Error   metanameErrorInfo `json:"error,omitempty"`
 }
 
+// decodeRPCResponses decodes a JSON-RPC response body, which may hold a
+// single response object or, in the batch form, an array of them, each with
+// its own result or error.
+func decodeRPCResponses(body []byte) ([]metanameResponse, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var responses []metanameResponse
+		if err := json.Unmarshal(trimmed, &responses); err != nil {
+			return nil, err
+		}
+		return responses, nil
+	}
+	var response metanameResponse
+	if err := json.Unmarshal(trimmed, &response); err != nil {
+		return nil, err
+	}
+	return []metanameResponse{response}, nil
+}
+
 type metanameErrorInfo struct {
 	Code    int         `json:"code"`
 	Data    interface{} `json:"data"`
@@ -0,0 +1,245 @@
+package metaname
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestMXPreferenceRoundTrip(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	_, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "", Type: "MX", Value: "0 .", TTL: time.Hour},
+		{Name: "mail", Type: "MX", Value: "0 mx.example.net.", TTL: time.Hour},
+		{Name: "www", Type: "MX", Value: "10 mx.example.net.", TTL: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range f.records("example.com") {
+		if rec["aux"] == nil {
+			t.Fatalf("expected the preference to be sent as aux; got %v", rec)
+		}
+		if rec["name"] == "@" && (rec["aux"] != float64(0) || rec["data"] != ".") {
+			t.Fatalf("expected the null MX to be stored as preference 0 and target .; got %v", rec)
+		}
+	}
+
+	records, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"": "0 .", "mail": "0 mx.example.net.", "www": "10 mx.example.net."}
+	for _, rec := range records {
+		if rec.Value != want[rec.Name] {
+			t.Fatalf("expected MX at %q to read back as %q; got %q", rec.Name, want[rec.Name], rec.Value)
+		}
+	}
+
+	if _, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "bad", Type: "MX", Value: "10 .", TTL: time.Hour},
+	}); err == nil {
+		t.Fatal("expected a null MX with a nonzero preference to be rejected")
+	}
+}
+
+func TestMXPreferenceOnSetAndUpdate(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	check := func(pref float64) {
+		t.Helper()
+		stored := f.records("example.com")
+		if len(stored) != 1 || stored[0]["aux"] != pref || stored[0]["data"] != "mail.example.com." {
+			t.Fatalf("expected preference %v in aux apart from the target; got %v", pref, stored)
+		}
+	}
+
+	if _, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "", Type: "MX", Value: "10 mail.example.com.", TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	check(10)
+
+	// Changing the preference moves the existing record, aux and all.
+	if _, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "", Type: "MX", Value: "20   mail.example.com", TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	check(20)
+}
+
+func TestSMIMEARoundTrip(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	name := "c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._smimecert"
+	value := "3 0 1 C0A8E6A2D7CF1E2F9D0C4B6A8E3F5D7B9A1C3E5F7092B4D6F8A0C2E4B6D8F0A2"
+	if _, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: name, Type: "SMIMEA", Value: value, TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	stored := f.records("example.com")
+	if len(stored) != 1 || stored[0]["data"] != value || stored[0]["aux"] != nil {
+		t.Fatalf("expected the SMIMEA value stored whole in data; got %v", stored)
+	}
+
+	records, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Type != "SMIMEA" || records[0].Name != name || records[0].Value != value {
+		t.Fatalf("expected the SMIMEA record read back as written; got %+v", records)
+	}
+
+	// The same association with its hex split and in lower case is the same
+	// record, so setting it changes nothing.
+	lower := "3 0 1 c0a8e6a2d7cf1e2f9d0c4b6a8e3f5d7b 9a1c3e5f7092b4d6f8a0c2e4b6d8f0a2"
+	if _, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: name, Type: "SMIMEA", Value: lower, TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.callCount("update_dns_record") + f.callCount("create_dns_record"); n != 1 {
+		t.Fatalf("expected no further writes; got %d writes in all", n)
+	}
+}
+
+func TestMetanameRRConversion(t *testing.T) {
+	cases := map[string]struct {
+		rec  libdns.Record
+		aux  int
+		data string
+	}{
+		"A":      {libdns.Record{Name: "www", Value: "192.0.2.1"}, -1, "192.0.2.1"},
+		"AAAA":   {libdns.Record{Name: "www", Value: "2001:db8::1"}, -1, "2001:db8::1"},
+		"CNAME":  {libdns.Record{Name: "alias", Value: "www.example.com."}, -1, "www.example.com."},
+		"MX":     {libdns.Record{Name: "", Value: "10 mail.example.com."}, 10, "mail.example.com."},
+		"NS":     {libdns.Record{Name: "sub", Value: "ns1.example.net."}, -1, "ns1.example.net."},
+		"PTR":    {libdns.Record{Name: "1", Value: "host.example.com."}, -1, "host.example.com."},
+		"SMIMEA": {libdns.Record{Name: "x._smimecert", Value: "3 0 1 C0A8"}, -1, "3 0 1 C0A8"},
+		"SRV":    {libdns.Record{Name: "_sip._tcp", Value: "0 20 5060 sip.example.com."}, 0, "20 5060 sip.example.com."},
+		"TXT":    {libdns.Record{Name: "", Value: "v=spf1 -all"}, -1, "v=spf1 -all"},
+	}
+	for rtype := range supportedTypes {
+		tc, ok := cases[rtype]
+		if !ok {
+			t.Fatalf("no conversion case for supported type %s", rtype)
+		}
+		rec := tc.rec
+		rec.Type = rtype
+		rec.TTL = time.Hour
+
+		mrec := toMetanameRR(rec)
+		wantName := rec.Name
+		if wantName == "" {
+			wantName = "@"
+		}
+		if mrec.Name != wantName || mrec.Type != rtype || mrec.Aux != tc.aux || mrec.Data != tc.data || mrec.Ttl != 3600 {
+			t.Fatalf("%s: unexpected conversion to %+v", rtype, mrec)
+		}
+
+		mrec.Reference = "ref1"
+		rec.ID = "ref1"
+		if back := fromMetanameRR(mrec, "example.com"); back != rec {
+			t.Fatalf("%s: expected %+v back; got %+v", rtype, rec, back)
+		}
+	}
+
+	// Names Metaname returns fully qualified are made relative.
+	back := fromMetanameRR(metanameRR{Name: "www.example.com.", Type: "A", Aux: -1, Data: "192.0.2.1"}, "example.com")
+	if back.Name != "www" {
+		t.Fatalf("expected a relative name; got %q", back.Name)
+	}
+}
+
+func TestTTLSeconds(t *testing.T) {
+	for ttl, want := range map[time.Duration]int{
+		0:                       0,
+		500 * time.Millisecond:  1,
+		time.Second:             1,
+		1500 * time.Millisecond: 2,
+		time.Hour:               3600,
+	} {
+		if got := ttlSeconds(ttl); got != want {
+			t.Fatalf("expected %s to be %d seconds; got %d", ttl, want, got)
+		}
+	}
+	if mrec := toMetanameRR(libdns.Record{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 500 * time.Millisecond}); mrec.Ttl != 1 {
+		t.Fatalf("expected a 500ms TTL to be sent as 1 second; got %d", mrec.Ttl)
+	}
+}
+
+func TestDecodeRPCResponses(t *testing.T) {
+	responses, err := decodeRPCResponses([]byte(`[
+		{"jsonrpc": "2.0", "id": "1", "error": {"code": -4, "message": "No such zone", "data": null}},
+		{"jsonrpc": "2.0", "id": "2", "result": "ref9"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 2 {
+		t.Fatalf("expected 2 responses; got %+v", responses)
+	}
+	if responses[0].Result != nil || responses[0].Error.Code != -4 || responses[0].Error.Message != "No such zone" {
+		t.Fatalf("expected the first response to carry its error; got %+v", responses[0])
+	}
+	if responses[1].Result != "ref9" || responses[1].Error.Code != 0 {
+		t.Fatalf("expected the second response to carry its result; got %+v", responses[1])
+	}
+
+	responses, err = decodeRPCResponses([]byte(`{"jsonrpc": "2.0", "id": "abc", "result": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 1 || responses[0].Result != true {
+		t.Fatalf("expected a single response; got %+v", responses)
+	}
+}
+
+func TestArrayResponseAccepted(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		w.Write([]byte(`[{"jsonrpc": "2.0", "id": "abc", "result": [{"reference": "r1", "name": "www", "type": "A", "ttl": 300, "aux": null, "data": "192.0.2.1"}]}]`))
+		return true
+	}
+	records, err := f.provider().GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != "r1" {
+		t.Fatalf("expected the record from the array response; got %+v", records)
+	}
+}
+
+func TestSRVRoundTrip(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	if _, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "_sip._tcp", Type: "SRV", Value: "10 20 5060 sip.example.com", TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	stored := f.records("example.com")
+	if len(stored) != 1 || stored[0]["aux"] != float64(10) || stored[0]["data"] != "20 5060 sip.example.com." {
+		t.Fatalf("expected the priority in aux and weight, port, and target in data; got %v", stored)
+	}
+
+	records, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Value != "10 20 5060 sip.example.com." {
+		t.Fatalf("expected all four SRV fields to read back; got %+v", records)
+	}
+}
@@ -0,0 +1,242 @@
+package metaname
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// NormalizeRecords returns records in zone as the Provider's methods would
+// send them, with default options, so that callers can preview records
+// assembled under mixed conventions. It fails with the error those methods
+// would give for a record Metaname can't take. The caller's slice is left
+// untouched.
+func NormalizeRecords(zone string, records []libdns.Record) ([]libdns.Record, error) {
+	if err := validateZone(zone); err != nil {
+		return nil, err
+	}
+	normalized := (&Provider{}).normalizeRecords(zone, records)
+	if err := validateRecords(normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// normalizeRecords returns a copy of records with each one normalized by
+// normalizeRecord, leaving the caller's slice untouched.
+func (p *Provider) normalizeRecords(zone string, records []libdns.Record) []libdns.Record {
+	out := make([]libdns.Record, len(records))
+	for i, rec := range records {
+		out[i] = p.normalizeRecord(zone, rec)
+	}
+	return out
+}
+
+// normalizeRecord puts rec, a record in zone, into the form Metaname
+// stores, so that the same record written in different ways is stored, and
+// matched, identically. The type is upper-cased.
+//
+// The zone apex, which libdns allows to be named either "" or "@", is
+// always named "" here, as it is in records read back, and a fully
+// qualified name with a trailing dot is made relative to the zone. Names
+// are otherwise left exactly as given: underscore labels such as "_dmarc"
+// and wildcards such as "*" are valid owner names, and case is preserved,
+// though names are matched without regard to it.
+//
+// Metaname reads hostname targets (of CNAME, MX, NS, PTR, and SRV records) the
+// way a zone file does: with a trailing dot they are fully qualified, and
+// without one they are relative to the zone. Callers rarely mean a multi-label
+// target like "example.net" to be relative, so a target containing a dot
+// is taken to be fully qualified and given its trailing dot, while a single
+// label like "www" is left relative. Setting LiteralTargets on the Provider
+// sends targets exactly as given instead.
+func (p *Provider) normalizeRecord(zone string, rec libdns.Record) libdns.Record {
+	rec.Type = strings.ToUpper(rec.Type)
+	if rec.Name == "@" {
+		rec.Name = ""
+	}
+	if strings.HasSuffix(rec.Name, ".") {
+		rec.Name = relativeName(rec.Name, zone)
+	}
+	if p.LiteralTargets {
+		return rec
+	}
+	switch rec.Type {
+	case "CNAME", "NS", "PTR":
+		rec.Value = qualifyTarget(escapeTarget(strings.TrimSpace(rec.Value)))
+	case "MX":
+		// An MX value may carry its preference ahead of the target.
+		switch fields := strings.Fields(rec.Value); len(fields) {
+		case 1:
+			rec.Value = qualifyTarget(escapeTarget(fields[0]))
+		case 2:
+			rec.Value = fields[0] + " " + qualifyTarget(escapeTarget(fields[1]))
+		default:
+			rec.Value = qualifyTarget(rec.Value)
+		}
+	case "SRV":
+		// The target is the last field, after the priority, if given, the
+		// weight, and the port.
+		if fields := strings.Fields(rec.Value); len(fields) == 3 || len(fields) == 4 {
+			last := len(fields) - 1
+			fields[last] = qualifyTarget(escapeTarget(fields[last]))
+			rec.Value = strings.Join(fields, " ")
+		}
+	}
+	return rec
+}
+
+// normalizeUpdate normalizes rec, an update to stored in zone, as
+// normalizeRecord does. A partial update, with neither name nor type, has
+// its value normalized as a value of the stored record's type.
+func (p *Provider) normalizeUpdate(zone string, stored metanameRR, rec libdns.Record) libdns.Record {
+	if rec.Name != "" || rec.Type != "" {
+		return p.normalizeRecord(zone, rec)
+	}
+	if rec.Value != "" && stored.Type != "" {
+		rec.Value = p.normalizeRecord(zone, libdns.Record{Type: stored.Type, Value: rec.Value}).Value
+	}
+	return rec
+}
+
+// escapeTarget writes a hostname target in zone file presentation format,
+// escaping with a backslash the characters that would otherwise end the
+// name or change its meaning there, and writing unprintable bytes as \DDD.
+// Escapes already present are kept as they are, so a target can be escaped
+// any number of times to the same result. Dots are left alone, since an
+// unescaped dot can only be a label separator.
+func escapeTarget(target string) string {
+	if target == "@" {
+		return target
+	}
+	var b strings.Builder
+	for i := 0; i < len(target); i++ {
+		c := target[i]
+		switch {
+		case c == '\\' && i+1 < len(target):
+			b.WriteByte(c)
+			b.WriteByte(target[i+1])
+			i++
+		case c == '\\':
+			b.WriteString(`\\`)
+		case strings.IndexByte(` "();@`, c) >= 0:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// withDefaultTTL gives rec the Provider's default TTL for its type, or else
+// DefaultTTL, if it has no TTL of its own. It applies only to records being
+// created: elsewhere a zero TTL means the existing TTL is to be left alone.
+func (p *Provider) withDefaultTTL(rec libdns.Record) libdns.Record {
+	if rec.TTL != 0 {
+		return rec
+	}
+	if ttl, ok := p.DefaultTTLs[rec.Type]; ok {
+		rec.TTL = ttl
+	} else {
+		rec.TTL = p.DefaultTTL
+	}
+	return rec
+}
+
+// qualifyTarget adds a trailing dot to a multi-label hostname target.
+func qualifyTarget(target string) string {
+	if target == "" || strings.HasSuffix(target, ".") || !strings.Contains(target, ".") {
+		return target
+	}
+	return target + "."
+}
+
+// relativeName makes a record name read from Metaname relative to zone, in
+// case it was returned fully qualified. Names already relative are returned
+// unchanged, and the zone's own name, or Metaname's "@", becomes the empty
+// apex name.
+func relativeName(name, zone string) string {
+	fqdn := strings.TrimSuffix(name, ".")
+	zone = strings.TrimSuffix(zone, ".")
+	if name == "@" {
+		return ""
+	}
+	if zone == "" {
+		return name
+	}
+	if strings.EqualFold(fqdn, zone) {
+		return ""
+	}
+	if suffix := "." + zone; len(fqdn) > len(suffix) && strings.EqualFold(fqdn[len(fqdn)-len(suffix):], suffix) {
+		return fqdn[:len(fqdn)-len(suffix)]
+	}
+	return name
+}
+
+// recordsMatch reports whether existing and rec describe the same record by
+// name, type, and value, ignoring TTL.
+func recordsMatch(existing, rec libdns.Record) bool {
+	return namesMatch(existing.Name, rec.Name) && existing.Type == rec.Type && valuesMatch(rec.Type, existing.Value, rec.Value)
+}
+
+// namesMatch reports whether two record names are the same. DNS names are
+// case-insensitive, so a record stored as "WWW" is the record named "www".
+func namesMatch(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
+
+// ttlMatches reports whether rec's TTL agrees with existing's. A zero TTL
+// means the caller didn't give one, so it agrees with any.
+func ttlMatches(existing, rec libdns.Record) bool {
+	return rec.TTL == 0 || existing.TTL == rec.TTL
+}
+
+// hostnameTypes are the record types whose values are made up of hostnames
+// and numbers, in which whitespace between fields is insignificant.
+var hostnameTypes = map[string]bool{
+	"CNAME": true,
+	"MX":    true,
+	"NS":    true,
+	"PTR":   true,
+	"SRV":   true,
+}
+
+// valuesMatch reports whether two values of a record of type rtype are the
+// same. Addresses are compared by value, since Metaname may store an IPv6
+// address expanded where the caller wrote it compressed, or vice versa.
+// Hostname values are compared ignoring stray whitespace, which can find
+// its way into records entered by hand, and certificate associations
+// ignoring the case and splitting of their hex data too, while other
+// values, TXT content in particular, must match exactly.
+func valuesMatch(rtype, a, b string) bool {
+	if a == b {
+		return true
+	}
+	switch {
+	case rtype == "A" || rtype == "AAAA":
+		ipA, ipB := net.ParseIP(strings.TrimSpace(a)), net.ParseIP(strings.TrimSpace(b))
+		return ipA != nil && ipB != nil && ipA.Equal(ipB)
+	case hostnameTypes[rtype]:
+		return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+	case rtype == "SMIMEA":
+		return certAssociation(a) == certAssociation(b)
+	}
+	return false
+}
+
+// certAssociation puts an SMIMEA value, "<usage> <selector> <matching type>
+// <hex data>", into a canonical form: single spaces between the three
+// numbers, and the data, which a zone file may split across several
+// fields, joined and in upper case.
+func certAssociation(value string) string {
+	fields := strings.Fields(value)
+	if len(fields) < 4 {
+		return strings.Join(fields, " ")
+	}
+	return strings.Join(fields[:3], " ") + " " + strings.ToUpper(strings.Join(fields[3:], ""))
+}
@@ -0,0 +1,354 @@
+package metaname
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestTargetTrailingDot(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	_, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "one", Type: "CNAME", Value: "target.example.net", TTL: 300},
+		{Name: "two", Type: "CNAME", Value: "target.example.net.", TTL: 300},
+		{Name: "three", Type: "CNAME", Value: "www", TTL: 300},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := map[string]string{}
+	for _, rec := range f.records("example.com") {
+		stored[rec["name"].(string)] = rec["data"].(string)
+	}
+	if stored["one"] != "target.example.net." || stored["two"] != "target.example.net." {
+		t.Fatalf("expected both targets stored fully qualified; got %q and %q", stored["one"], stored["two"])
+	}
+	if stored["three"] != "www" {
+		t.Fatalf("expected single-label target to stay relative; got %q", stored["three"])
+	}
+
+	// Deleting with the undotted form matches the stored record.
+	deleted, err := p.DeleteRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "one", Type: "CNAME", Value: "target.example.net"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 {
+		t.Fatalf("expected 1 record deleted; got %d", len(deleted))
+	}
+
+	p.LiteralTargets = true
+	if _, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "four", Type: "CNAME", Value: "sub.www", TTL: 300},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range f.records("example.com") {
+		if rec["name"] == "four" && rec["data"] != "sub.www" {
+			t.Fatalf("expected literal target to be sent unchanged; got %q", rec["data"])
+		}
+	}
+}
+
+func TestFQDNNamesMadeRelative(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www.example.com.", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "api.dev.example.com", "type": "A", "ttl": 300, "data": "192.0.2.2"})
+	f.addRecord("example.com", map[string]interface{}{"name": "example.com.", "type": "TXT", "ttl": 300, "data": "apex"})
+	f.addRecord("example.com", map[string]interface{}{"name": "notexample.com", "type": "TXT", "ttl": 300, "data": "relative"})
+	p := f.provider()
+
+	records, err := p.GetRecords(context.Background(), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]string{}
+	for _, rec := range records {
+		names[rec.Value] = rec.Name
+	}
+	want := map[string]string{"192.0.2.1": "www", "192.0.2.2": "api.dev", "apex": "", "relative": "notexample.com"}
+	for value, name := range want {
+		if names[value] != name {
+			t.Fatalf("expected record %q to be named %q; got %q", value, name, names[value])
+		}
+	}
+}
+
+func TestAtNameReadAsApex(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "MX", "ttl": 300, "aux": 10, "data": "mail.example.com."})
+	p := f.provider()
+
+	records, err := p.GetCustomRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records; got %+v", records)
+	}
+	for _, rec := range records {
+		if rec.Name != "" {
+			t.Fatalf("expected %s record named @ to be read with an empty name; got %q", rec.Type, rec.Name)
+		}
+	}
+}
+
+func TestApexTXT(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	if _, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "", Type: "TXT", Value: "v=spf1 -all", TTL: 300},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	stored := f.records("example.com")
+	if len(stored) != 1 || stored[0]["name"] != "@" {
+		t.Fatalf("expected the TXT record to be written at the apex as @; got %v", stored)
+	}
+
+	records, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Name != "" || records[0].Value != "v=spf1 -all" {
+		t.Fatalf("expected the apex TXT record to be read back with an empty name; got %+v", records)
+	}
+
+	// Either apex spelling matches it for deletion.
+	deleted, err := p.DeleteRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "@", Type: "TXT", Value: "v=spf1 -all"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 {
+		t.Fatalf("expected 1 record deleted; got %d", len(deleted))
+	}
+}
+
+func TestNamesMatchedWithoutCase(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "WWW", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "Mail", "type": "A", "ttl": 300, "data": "192.0.2.2"})
+	p := f.provider()
+
+	deleted, err := p.DeleteRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 {
+		t.Fatalf("expected the record stored as WWW to be deleted; deleted %d", len(deleted))
+	}
+
+	// Setting under a differently cased name updates the existing record in
+	// place rather than adding a second set.
+	if _, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "mail", Type: "A", Value: "192.0.2.3", TTL: 300 * time.Second},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	stored := f.records("example.com")
+	if len(stored) != 1 || stored[0]["data"] != "192.0.2.3" {
+		t.Fatalf("expected the one record updated in place; got %v", stored)
+	}
+}
+
+func TestAAAAMatchedByValue(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "AAAA", "ttl": 300, "data": "2001:0db8:0000:0000:0000:0000:0000:0001"})
+	p := f.provider()
+
+	deleted, err := p.DeleteRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "AAAA", Value: "2001:db8::1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || len(f.records("example.com")) != 0 {
+		t.Fatalf("expected the expanded AAAA record to be deleted; deleted %d", len(deleted))
+	}
+}
+
+func TestSpecialNamesPreserved(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	names := []string{"_dmarc", "_acme-challenge.WWW", "*", "*.dev", "_sip._tcp"}
+	var records []libdns.Record
+	for _, name := range names {
+		records = append(records, libdns.Record{Name: name, Type: "TXT", Value: "v", TTL: 300})
+	}
+	records = append(records, libdns.Record{Name: "*", Type: "A", Value: "192.0.2.1", TTL: 300})
+	if _, err := p.AppendRecords(context.Background(), "example.com", records); err != nil {
+		t.Fatal(err)
+	}
+	read, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, rec := range read {
+		got[rec.Name+" "+rec.Type] = true
+	}
+	for _, name := range names {
+		if !got[name+" TXT"] {
+			t.Fatalf("expected name %q to be preserved exactly; got %v", name, got)
+		}
+	}
+	if !got["* A"] {
+		t.Fatalf("expected wildcard A record; got %v", got)
+	}
+}
+
+func TestHostnameMatchingIgnoresWhitespace(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "alias", "type": "CNAME", "ttl": 300, "data": "www.example.com. "})
+	f.addRecord("example.com", map[string]interface{}{"name": "note", "type": "TXT", "ttl": 300, "data": "hello "})
+	p := f.provider()
+
+	deleted, err := p.DeleteRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "alias", Type: "CNAME", Value: "www.example.com."},
+		{Name: "note", Type: "TXT", Value: "hello"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0].Type != "CNAME" {
+		t.Fatalf("expected only the CNAME to match despite its trailing space; got %+v", deleted)
+	}
+	remaining := f.records("example.com")
+	if len(remaining) != 1 || remaining[0]["data"] != "hello " {
+		t.Fatalf("expected the TXT record, whose content must match exactly, to remain; got %v", remaining)
+	}
+}
+
+func TestReverseZonePTR(t *testing.T) {
+	for _, tc := range []struct{ zone, stored, name string }{
+		{"2.0.192.in-addr.arpa", "1", "1"},
+		{"2.0.192.in-addr.arpa", "1.2.0.192.in-addr.arpa.", "1"},
+		{"8.b.d.0.1.0.0.2.ip6.arpa", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0"},
+	} {
+		f := newFakeMetaname(t, tc.zone)
+		f.addRecord(tc.zone, map[string]interface{}{"name": tc.stored, "type": "PTR", "ttl": 3600, "data": "host.example.com."})
+		p := f.provider()
+
+		records, err := p.GetRecords(context.Background(), tc.zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 || records[0].Name != tc.name || records[0].Value != "host.example.com." {
+			t.Fatalf("expected PTR %q in %s to be read as %q; got %+v", tc.stored, tc.zone, tc.name, records)
+		}
+	}
+
+	f := newFakeMetaname(t, "2.0.192.in-addr.arpa")
+	p := f.provider()
+	if _, err := p.AppendRecords(context.Background(), "2.0.192.in-addr.arpa", []libdns.Record{
+		{Name: "7", Type: "PTR", Value: "mail.example.com", TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	stored := f.records("2.0.192.in-addr.arpa")
+	if len(stored) != 1 || stored[0]["name"] != "7" || stored[0]["data"] != "mail.example.com." {
+		t.Fatalf("expected the PTR to be written with its label and a qualified target; got %v", stored)
+	}
+}
+
+func TestNormalizeRecords(t *testing.T) {
+	for _, tc := range []struct {
+		rule      string
+		rec, want libdns.Record
+	}{
+		{"apex @", libdns.Record{Name: "@", Type: "A", Value: "192.0.2.1"}, libdns.Record{Name: "", Type: "A", Value: "192.0.2.1"}},
+		{"qualified name", libdns.Record{Name: "www.example.com.", Type: "A", Value: "192.0.2.1"}, libdns.Record{Name: "www", Type: "A", Value: "192.0.2.1"}},
+		{"qualified apex", libdns.Record{Name: "Example.COM.", Type: "A", Value: "192.0.2.1"}, libdns.Record{Name: "", Type: "A", Value: "192.0.2.1"}},
+		{"undotted name", libdns.Record{Name: "www.example.com", Type: "A", Value: "192.0.2.1"}, libdns.Record{Name: "www.example.com", Type: "A", Value: "192.0.2.1"}},
+		{"name case", libdns.Record{Name: "WWW", Type: "A", Value: "192.0.2.1"}, libdns.Record{Name: "WWW", Type: "A", Value: "192.0.2.1"}},
+		{"special name", libdns.Record{Name: "_dmarc", Type: "TXT", Value: "v=DMARC1"}, libdns.Record{Name: "_dmarc", Type: "TXT", Value: "v=DMARC1"}},
+		{"type case", libdns.Record{Name: "www", Type: "cname", Value: "example.net"}, libdns.Record{Name: "www", Type: "CNAME", Value: "example.net."}},
+		{"relative target", libdns.Record{Name: "alias", Type: "CNAME", Value: "www"}, libdns.Record{Name: "alias", Type: "CNAME", Value: "www"}},
+		{"dotted target", libdns.Record{Name: "", Type: "NS", Value: "ns1.example.net."}, libdns.Record{Name: "", Type: "NS", Value: "ns1.example.net."}},
+		{"MX target", libdns.Record{Name: "", Type: "MX", Value: "10 mail.example.com"}, libdns.Record{Name: "", Type: "MX", Value: "10 mail.example.com."}},
+		{"SRV target", libdns.Record{Name: "_sip._tcp", Type: "SRV", Value: "10 20 5060 sip.example.com"}, libdns.Record{Name: "_sip._tcp", Type: "SRV", Value: "10 20 5060 sip.example.com."}},
+		{"SRV escaped target", libdns.Record{Name: "_sip._tcp", Type: "SRV", Value: "10 20 5060 sip;box.example.com."}, libdns.Record{Name: "_sip._tcp", Type: "SRV", Value: `10 20 5060 sip\;box.example.com.`}},
+		{"SRV relative target", libdns.Record{Name: "_sip._tcp", Type: "SRV", Value: "20 5060 sip"}, libdns.Record{Name: "_sip._tcp", Type: "SRV", Value: "20 5060 sip"}},
+		{"TXT value", libdns.Record{Name: "", Type: "TXT", Value: "example.com"}, libdns.Record{Name: "", Type: "TXT", Value: "example.com"}},
+	} {
+		records := []libdns.Record{tc.rec}
+		got, err := NormalizeRecords("example.com", records)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.rule, err)
+		}
+		if got[0] != tc.want {
+			t.Fatalf("%s: expected %+v; got %+v", tc.rule, tc.want, got[0])
+		}
+		if records[0] != tc.rec {
+			t.Fatalf("%s: expected the input left untouched; got %+v", tc.rule, records[0])
+		}
+	}
+
+	if _, err := NormalizeRecords("example.com", []libdns.Record{{Name: "@", Type: "CNAME", Value: "example.net"}}); err == nil {
+		t.Fatal("expected an apex CNAME to be rejected")
+	}
+	if _, err := NormalizeRecords("not a zone", nil); err == nil {
+		t.Fatal("expected an invalid zone to be rejected")
+	}
+}
+
+func TestTargetEscaping(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	if _, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "odd", Type: "CNAME", Value: "odd(name).example.net", TTL: 300},
+		{Name: "kept", Type: "CNAME", Value: `a\032b.example.net.`, TTL: 300},
+		{Name: "", Type: "MX", Value: "10 mail;box.example.net.", TTL: 300},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	stored := make(map[string]string)
+	for _, rec := range f.records("example.com") {
+		stored[rec["name"].(string)] = rec["data"].(string)
+	}
+	want := map[string]string{
+		"odd":  `odd\(name\).example.net.`,
+		"kept": `a\032b.example.net.`,
+		"@":    `mail\;box.example.net.`,
+	}
+	for name, data := range want {
+		if stored[name] != data {
+			t.Fatalf("expected %s to be stored as %q; got %q", name, data, stored[name])
+		}
+	}
+
+	// A target Metaname returns unescaped is read back escaped, so it reads
+	// the same however it was stored.
+	f.addRecord("example.com", map[string]interface{}{"name": "raw", "type": "CNAME", "ttl": 300, "data": "with space.example.net."})
+	records, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := make(map[string]string)
+	for _, rec := range records {
+		read[rec.Name] = rec.Value
+	}
+	if read["odd"] != want["odd"] || read["kept"] != want["kept"] || read[""] != "10 "+want["@"] {
+		t.Fatalf("expected escaped targets to read back as written; got %v", read)
+	}
+	if read["raw"] != `with\ space.example.net.` {
+		t.Fatalf("expected the unescaped target read back escaped; got %q", read["raw"])
+	}
+
+	if got := escapeTarget(escapeTarget("a b\\")); got != `a\ b\\` {
+		t.Fatalf("expected escaping to be idempotent; got %q", got)
+	}
+}
@@ -0,0 +1,44 @@
+package metaname
+
+import (
+	"context"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// defaultPollInterval is how often WaitForPropagation checks when it isn't
+// given an interval.
+const defaultPollInterval = 5 * time.Second
+
+// WaitForPropagation polls the zone every pollInterval until it holds a
+// record at name of type rtype with value, returning nil once it does or
+// the context's error once the context ends. This is useful after writing
+// an ACME challenge record, before asking the CA to look for it.
+//
+// It watches the zone as Metaname's API reports it, which is what
+// Metaname's nameservers serve; it doesn't query resolvers elsewhere.
+func (p *Provider) WaitForPropagation(ctx context.Context, zone, name, rtype, value string, pollInterval time.Duration) error {
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	want := p.normalizeRecord(zone, libdns.Record{Name: name, Type: rtype, Value: value})
+	for {
+		records, err := p.GetRecords(WithoutCache(ctx), zone)
+		if err != nil {
+			return err
+		}
+		for _, rec := range records {
+			if recordsMatch(rec, want) {
+				return nil
+			}
+		}
+		timer := time.NewTimer(pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package metaname
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWaitForPropagation(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	polls := 0
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		if method == "dns_zone" {
+			polls++
+			if polls == 2 {
+				f.addRecord("example.com", map[string]interface{}{"name": "_acme-challenge", "type": "TXT", "ttl": 60, "data": "token"})
+			}
+		}
+		return false
+	}
+	p := f.provider()
+
+	if err := p.WaitForPropagation(context.Background(), "example.com", "_acme-challenge", "TXT", "token", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if polls != 2 {
+		t.Fatalf("expected the record to be found on the second poll; took %d", polls)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := p.WaitForPropagation(ctx, "example.com", "_acme-challenge", "TXT", "other", 10*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to end with the context; got %v", err)
+	}
+}
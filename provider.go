@@ -4,155 +4,398 @@ package metaname
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/libdns/libdns"
 )
 
+// CustomRecord is a libdns.Record together with Metaname-specific metadata
+// about it.
+type CustomRecord struct {
+	libdns.Record
+	Metadata map[string]string
+
+	// stored is the record as Metaname returned it.
+	stored metanameRR
+}
+
+// Unwrap returns the plain libdns.Record, without the metadata.
+func (r CustomRecord) Unwrap() libdns.Record {
+	return r.Record
+}
+
 // Provider facilitates DNS record manipulation with Metaname
+//
+// A Provider is safe for concurrent use by multiple goroutines once
+// configured; its requests to Metaname are made one at a time. A request
+// waiting its turn gives up when its context ends, and a request waiting to
+// be retried lets others go ahead in the meantime.
 type Provider struct {
 	APIKey           string `json:"api_key,omitempty"`
 	AccountReference string `json:"account_reference,omitempty"`
 	Endpoint         string `json:"endpoint,omitempty"`
 
+	// Environment selects the API endpoint by name when Endpoint is unset:
+	// "production" (the default) or "test". Endpoint itself may be any URL,
+	// including a plain http:// one such as a local test server's.
+	Environment string `json:"environment,omitempty"`
+
+	// HTTPClient, if set, is used for every request, with its own transport
+	// settings. Otherwise http.DefaultClient is used, unless MaxIdleConns or
+	// MaxConnsPerHost is set.
+	HTTPClient *http.Client `json:"-"`
+
+	// MaxIdleConns and MaxConnsPerHost, if either is set and HTTPClient
+	// isn't, give the Provider its own transport, with Go's defaults
+	// otherwise, that keeps up to MaxIdleConns connections open between
+	// requests and opens no more than MaxConnsPerHost at once. Metaname is
+	// a single host, so both limits apply to its connections. Go's defaults
+	// keep 2 idle connections and put no limit on open ones; tooling making
+	// many requests concurrently may want, say, 10 of each.
+	MaxIdleConns    int `json:"max_idle_conns,omitempty"`
+	MaxConnsPerHost int `json:"max_conns_per_host,omitempty"`
+
+	// MaxRetries is how many times a request is retried after a rate-limit
+	// response or transport failure. A create isn't retried after a
+	// transport failure, since it may have reached Metaname before the
+	// connection failed and would then be made twice; it is still retried
+	// after Metaname refuses it outright. The default of zero never retries,
+	// except that reads, which are always safe to repeat, are retried twice
+	// after a transport failure or a spurious internal error regardless.
+	// Retries apply to each request in a batch, so a batch that hits the
+	// rate limit partway pauses and then carries on with the rest.
+	MaxRetries int `json:"max_retries,omitempty"`
+
+	// MaxRetryDelay caps the wait before any single retry, including one
+	// requested by Metaname. The default is 30 seconds.
+	MaxRetryDelay time.Duration `json:"max_retry_delay,omitempty"`
+
+	// MaxRetryDuration bounds the total time spent on one request including
+	// its retries: no retry is made that would start after it has elapsed.
+	// The default of zero leaves only MaxRetries and the context to bound it.
+	MaxRetryDuration time.Duration `json:"max_retry_duration,omitempty"`
+
+	// CacheTTL keeps each zone's listing for this long, so that repeated
+	// reads don't each call Metaname. Changes made through the Provider
+	// discard the zone's listing, but changes made elsewhere go unseen
+	// until it expires or a read is made with WithoutCache. Methods that
+	// change records always read the zone afresh to plan their changes.
+	// The default of zero doesn't cache.
+	CacheTTL time.Duration `json:"cache_ttl,omitempty"`
+
+	// MaxBatchRetries, if set, caps the retries made across all the
+	// requests of one batch operation, such as AppendRecords or ApplyZone,
+	// so that a batch meeting persistent failures gives up rather than
+	// retrying every one of its requests MaxRetries times. The default of
+	// zero leaves each request to MaxRetries alone.
+	MaxBatchRetries int `json:"max_batch_retries,omitempty"`
+
+	// DefaultTTL is the TTL given to records created without one. When it
+	// is unset, Metaname chooses the TTL of such records.
+	DefaultTTL time.Duration `json:"default_ttl,omitempty"`
+
+	// DefaultTTLs gives, by record type, TTLs for records created without
+	// one, such as a short TTL for TXT records used in ACME challenges.
+	// Types not listed get DefaultTTL.
+	DefaultTTLs map[string]time.Duration `json:"default_ttls,omitempty"`
+
+	// LiteralTargets sends CNAME, MX, NS, PTR, and SRV targets exactly
+	// as given, rather than qualifying multi-label targets with a trailing
+	// dot.
+	LiteralTargets bool `json:"literal_targets,omitempty"`
+
+	// IncludeForwardingEntries makes GetRecords list any web and email
+	// forwarding entries Metaname lists alongside DNS records, recognised
+	// by their URL, FRAME, and MAIL types. These aren't DNS records that
+	// can be managed through libdns, so by default only GetCustomRecords
+	// lists them.
+	IncludeForwardingEntries bool `json:"include_forwarding_entries,omitempty"`
+
+	// CheckZoneOwnership makes every method that changes a zone first check
+	// that the zone is one of the account's domains, failing with
+	// ErrZoneNotOwned if not. It costs an extra request each time.
+	CheckZoneOwnership bool `json:"check_zone_ownership,omitempty"`
+
+	// ConditionalUpdates makes SetRecords and ApplyZone check, just before
+	// changing anything, that the records they are about to update are as
+	// they were when the zone was read, failing with ErrRecordChanged if
+	// not. Metaname has no conditional update of its own, so this narrows
+	// the window for overwriting a concurrent change rather than closing it.
+	ConditionalUpdates bool `json:"conditional_updates,omitempty"`
+
+	// DeleteSystemRecords lets SetRecords and ApplyZone delete records that
+	// Metaname manages itself. By default they are preserved.
+	DeleteSystemRecords bool `json:"delete_system_records,omitempty"`
+
+	// DeleteUnsupportedTypes lets ApplyZone delete existing records of types
+	// the provider doesn't model. By default they are preserved.
+	DeleteUnsupportedTypes bool `json:"delete_unsupported_types,omitempty"`
+
+	// ReadOnly makes every method that would change a zone fail with
+	// ErrReadOnly before sending anything, for deployments such as
+	// monitoring that must never change one. Reads work as usual.
+	ReadOnly bool `json:"read_only,omitempty"`
+
+	// OnCreate, OnUpdate, and OnDelete, if set, are called after each record
+	// the Provider creates, updates, or deletes, for auditing or tests.
+	OnCreate RecordHook `json:"-"`
+	OnUpdate RecordHook `json:"-"`
+	OnDelete RecordHook `json:"-"`
+
+	// OnRawResponse, if set, is called with the body of each response
+	// Metaname returns, before it is parsed, and the method it answers, for
+	// logging what Metaname said when something goes wrong. It is called
+	// once the request is finished with, so it may use the Provider itself.
+	OnRawResponse func(method string, raw []byte) `json:"-"`
+
+	// turn holds a token while a request to Metaname is in flight; see
+	// takeTurn.
+	turnOnce sync.Once
+	turn     chan struct{}
+
+	// mutex guards cache and cacheGeneration.
 	mutex sync.Mutex
+
+	// rateLimit is the rate-limit state Metaname last reported, guarded by
+	// usageMutex since it's updated from every request.
+	usageMutex sync.Mutex
+	rateLimit  rateLimitState
+
+	// httpClient is the client built for MaxIdleConns and MaxConnsPerHost.
+	httpOnce   sync.Once
+	httpClient *http.Client
+
+	// cache holds zone listings for CacheTTL. cacheGeneration counts the
+	// changes made through the Provider, so that a listing read while a
+	// change was being made isn't cached.
+	cache           map[string]cachedZone
+	cacheGeneration uint64
+
+	// client, if set, replaces the HTTP API for record operations.
+	client rpcClient
+}
+
+// ProviderFromEnv creates a Provider from the METANAME_API_KEY and
+// METANAME_ACCOUNT_REFERENCE environment variables, both of which must be
+// set. METANAME_ENVIRONMENT optionally selects the environment, and
+// METANAME_ENDPOINT overrides the API endpoint.
+func ProviderFromEnv() (*Provider, error) {
+	apiKey := os.Getenv("METANAME_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("METANAME_API_KEY is not set")
+	}
+	accountReference := os.Getenv("METANAME_ACCOUNT_REFERENCE")
+	if accountReference == "" {
+		return nil, fmt.Errorf("METANAME_ACCOUNT_REFERENCE is not set")
+	}
+	return &Provider{
+		APIKey:           apiKey,
+		AccountReference: accountReference,
+		Endpoint:         os.Getenv("METANAME_ENDPOINT"),
+		Environment:      os.Getenv("METANAME_ENVIRONMENT"),
+	}, nil
 }
 
-// GetRecords lists all the records in the zone.
+// GetRecords lists all the records in the zone, sorted by name, then type,
+// then value. Forwarding entries are left out unless IncludeForwardingEntries
+// is set. A zone with no records gives an empty, non-nil list, while a zone
+// Metaname doesn't host gives an error wrapping ErrZoneNotFound.
 func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
-	metanameRecords, err := p.dns_zone(ctx, zone)
+	customRecords, err := p.GetCustomRecords(ctx, zone)
 	if err != nil {
 		return nil, err
 	}
 
-	var libRecords []libdns.Record
-	for _, rec := range metanameRecords {
-		rec := libdns.Record{
-			ID:    rec.Reference,
-			Type:  rec.Type,
-			Name:  rec.Name,
-			TTL:   time.Duration(rec.Ttl) * time.Second,
-			Value: rec.Data,
+	libRecords := []libdns.Record{}
+	for _, rec := range customRecords {
+		if _, ok := rec.Metadata["forwarding"]; ok && !p.IncludeForwardingEntries {
+			continue
 		}
-
-		libRecords = append(libRecords, rec)
+		libRecords = append(libRecords, rec.Unwrap())
 	}
 
 	return libRecords, nil
 }
 
+// GetCustomRecords lists all the records in the zone along with the
+// Metaname-specific details that don't fit in a libdns.Record, as described
+// by recordMetadata.
+func (p *Provider) GetCustomRecords(ctx context.Context, zone string) ([]CustomRecord, error) {
+	if err := validateZone(zone); err != nil {
+		return nil, err
+	}
+	metanameRecords, err := p.rpc().dns_zone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	records := []CustomRecord{}
+	for _, mrec := range metanameRecords {
+		rec := CustomRecord{
+			Record:   fromMetanameRR(mrec, zone),
+			Metadata: recordMetadata(mrec, zone),
+			stored:   mrec,
+		}
+		fetched := mrec.fetched
+		if fetched.IsZero() {
+			fetched = now
+		}
+		rec.Metadata["fetched_at"] = fetched.UTC().Format(time.RFC3339)
+
+		records = append(records, rec)
+	}
+	markGlue(records, zone)
+
+	// Metaname doesn't return records in a stable order.
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Value != b.Value {
+			return a.Value < b.Value
+		}
+		return a.ID < b.ID
+	})
+
+	return records, nil
+}
+
 // AppendRecords adds records to the zone. It returns the records that were added.
+// If the context ends or a record fails partway, the records added so far are
+// returned along with the error.
+//
+// Metaname assigns each new record's reference itself, so records to be added
+// must not have an ID; records copied from elsewhere need theirs cleared.
 func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	ctx = p.withRetryBudget(ctx)
+	if err := p.checkWritable(zone); err != nil {
+		return nil, err
+	}
+	if err := p.checkZone(ctx, zone); err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		if rec.ID != "" {
+			return nil, fmt.Errorf("invalid record %s %s: Metaname assigns references to new records, so ID %q can't be used", rec.Type, displayName(rec.Name), rec.ID)
+		}
+	}
+	records = p.normalizeRecords(zone, records)
+	if err := validateRecords(records); err != nil {
+		return nil, err
+	}
 	var added []libdns.Record
 	for _, rec := range records {
-		mrec := metanameRR{
-			Name: rec.Name,
-			Type: rec.Type,
-			Ttl:  int(rec.TTL.Seconds()),
-			Data: rec.Value,
+		if err := ctx.Err(); err != nil {
+			return added, err
 		}
-		ref, err := p.create_dns_record(ctx, zone, mrec)
+		rec = p.withDefaultTTL(rec)
+		ref, err := p.rpc().create_dns_record(ctx, zone, toMetanameRR(rec))
 		if err != nil {
-			return nil, err
+			return added, recordError("create", zone, rec, err)
 		}
 		if ref != "" {
 			rec.ID = ref
 			added = append(added, rec)
+			p.created(zone, rec, ref)
 		}
 	}
 	return added, nil
 }
 
 // SetRecords sets the records in the zone, either by updating existing records or creating new ones.
+// Records given with an ID are updated directly. Otherwise the records of each name and type in the input
+// replace the existing records of that name and type: matching values are kept, other existing records are
+// updated in place to take the new values, and only then are new records created or extras deleted.
 // It returns the updated records.
 func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	var updated []libdns.Record
-	var existing []libdns.Record
-	var err error
-	for _, rec := range records {
-		mrec := metanameRR{
-			Name: rec.Name,
-			Type: rec.Type,
-			Ttl:  int(rec.TTL.Seconds()),
-			Data: rec.Value,
-		}
-		if rec.ID != "" {
-			err := p.update_dns_record(ctx, zone, rec.ID, mrec)
-			if err != nil {
-				return updated, err
-			}
-			updated = append(updated, rec)
-		} else {
-			if existing == nil {
-				existing, err = p.GetRecords(ctx, zone)
-				if err != nil {
-					return updated, err
-				}
-			}
-			replaced := false
-			// When only the new record data is given, find an existing record with the same name and type, provided it
-			// is a CNAME/A/AAAA record. For all other records, a new record will be created below.
-			for _, cur := range existing {
-				if cur.Name == rec.Name && cur.Type == rec.Type && (cur.Type == "CNAME" || cur.Type == "A" || cur.Type == "AAAA") {
-					newrec := metanameRR{Name: rec.Name, Type: rec.Type, Data: rec.Value, Ttl: int(rec.TTL.Seconds())}
-					err := p.update_dns_record(ctx, zone, cur.ID, newrec)
-					if err != nil {
-						return updated, err
-					}
-					rec.ID = cur.ID
-					updated = append(updated, rec)
-					replaced = true
-				}
-			}
-			if !replaced {
-				ref, err := p.create_dns_record(ctx, zone, mrec)
-				if err != nil {
-					return updated, err
-				}
-				if ref != "" {
-					rec.ID = ref
-					updated = append(updated, rec)
-				}
-			}
-		}
+	ctx = p.withRetryBudget(ctx)
+	if err := p.checkWritable(zone); err != nil {
+		return nil, err
 	}
-	return updated, nil
-
+	if err := p.checkZone(ctx, zone); err != nil {
+		return nil, err
+	}
+	records = p.normalizeRecords(zone, records)
+	if err := validateRecords(records); err != nil {
+		return nil, err
+	}
+	existing, err := p.GetCustomRecords(WithoutCache(ctx), zone)
+	if err != nil {
+		return nil, err
+	}
+	plan := planReconcile(existing, records, false)
+	plan.deletes = p.deletable(plan.deletes)
+	return p.applyPlan(ctx, zone, plan)
 }
 
-// DeleteRecords deletes the records from the zone. It returns the records that were deleted.
+// DeleteRecords deletes the records from the zone. Records with an ID are
+// deleted by reference; others delete every existing record of the same
+// name, type, and value, whatever the TTL. It returns one record for each
+// record actually removed, so the result can be longer than records when
+// the zone held duplicates, or shorter when some matched nothing. Records
+// deleted by reference are returned as given, and matched records as they
+// were stored, with their IDs.
 func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	ctx = p.withRetryBudget(ctx)
+	if err := p.checkWritable(zone); err != nil {
+		return nil, err
+	}
+	if err := p.checkZone(ctx, zone); err != nil {
+		return nil, err
+	}
+	records = p.normalizeRecords(zone, records)
 	var deleted []libdns.Record
 	var existing []libdns.Record
+	removed := make(map[string]bool)
 	var err error
 	for _, rec := range records {
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
 		if rec.ID != "" {
-			r, err := p.delete_dns_record(ctx, zone, rec.ID)
+			if removed[rec.ID] {
+				continue
+			}
+			r, err := p.rpc().delete_dns_record(ctx, zone, rec.ID)
 			if err != nil {
-				return deleted, err
+				return deleted, recordError("delete", zone, rec, err)
 			}
 			if r {
+				removed[rec.ID] = true
 				deleted = append(deleted, rec)
+				p.deleted(zone, rec, rec.ID)
 			}
 		} else {
 			if existing == nil {
-				existing, err = p.GetRecords(ctx, zone)
+				existing, err = p.GetRecords(WithoutCache(ctx), zone)
 				if err != nil {
 					return deleted, err
 				}
 			}
 			// When only record data was provided to delete, match only if name, type, and value match
-			// exactly (ignoring TTL).
+			// (ignoring TTL).
 			for _, cur := range existing {
-				if cur.Name == rec.Name && cur.Type == rec.Type && cur.Value == rec.Value {
-					r, err := p.delete_dns_record(ctx, zone, cur.ID)
-					if err != nil {
-						return deleted, err
-					}
-					if r {
-						deleted = append(deleted, rec)
-					}
+				if removed[cur.ID] || !recordsMatch(cur, rec) {
+					continue
+				}
+				r, err := p.rpc().delete_dns_record(ctx, zone, cur.ID)
+				if err != nil {
+					return deleted, recordError("delete", zone, cur, err)
+				}
+				if r {
+					removed[cur.ID] = true
+					deleted = append(deleted, cur)
+					p.deleted(zone, cur, cur.ID)
 				}
 			}
 		}
@@ -160,6 +403,15 @@ func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []lib
 	return deleted, nil
 }
 
+// recordError describes a failure to change rec in zone, so that it's clear
+// which record of a batch failed.
+func recordError(op string, zone string, rec libdns.Record, err error) error {
+	if rec.Type == "" && rec.Name == "" {
+		return fmt.Errorf("failed to %s record %s in %s: %w", op, rec.ID, zone, err)
+	}
+	return fmt.Errorf("failed to %s %s %s (%q) in %s: %w", op, rec.Type, rec.Name, rec.Value, zone, err)
+}
+
 // Interface guards
 var (
 	_ libdns.RecordGetter   = (*Provider)(nil)
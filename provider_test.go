@@ -0,0 +1,670 @@
+package metaname
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestCustomRecordUnwrap(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "CNAME", "ttl": 300, "data": "example.net."})
+	p := f.provider()
+
+	records, err := p.GetCustomRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record; got %d", len(records))
+	}
+	var rec interface{} = records[0].Unwrap()
+	switch r := rec.(type) {
+	case CustomRecord:
+		t.Fatal("expected Unwrap to return the plain record, not the wrapper")
+	case libdns.Record:
+		if r.Name != "www" || r.Type != "CNAME" || r.Value != "example.net." {
+			t.Fatalf("unexpected unwrapped record %+v", r)
+		}
+	default:
+		t.Fatalf("unexpected type %T", r)
+	}
+}
+
+func TestErrorsIdentifyRecord(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	// The fake rejects records without data.
+	_, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "ok", Type: "TXT", Value: "fine"},
+		{Name: "www", Type: "TXT"},
+	})
+	if err == nil {
+		t.Fatal("expected error from create")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "failed to create TXT www") || !strings.Contains(msg, "in example.com") {
+		t.Fatalf("expected error to identify the record and zone; got %q", msg)
+	}
+}
+
+func TestProviderFromEnv(t *testing.T) {
+	setenv(t, "METANAME_API_KEY", "key")
+	setenv(t, "METANAME_ACCOUNT_REFERENCE", "ab12")
+	setenv(t, "METANAME_ENDPOINT", "https://test.metaname.net/api/1.1")
+	p, err := ProviderFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.APIKey != "key" || p.AccountReference != "ab12" || p.Endpoint != "https://test.metaname.net/api/1.1" {
+		t.Fatalf("unexpected provider %+v", p)
+	}
+
+	setenv(t, "METANAME_ACCOUNT_REFERENCE", "")
+	if _, err := ProviderFromEnv(); err == nil || !strings.Contains(err.Error(), "METANAME_ACCOUNT_REFERENCE") {
+		t.Fatalf("expected error naming the missing variable; got %v", err)
+	}
+}
+
+// setenv sets an environment variable for the duration of the test.
+func setenv(t *testing.T, key, value string) {
+	old, had := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if had {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestGetRecordsOrder(t *testing.T) {
+	raw := []map[string]interface{}{
+		{"name": "www", "type": "TXT", "ttl": 300, "data": "b"},
+		{"name": "api", "type": "A", "ttl": 300, "data": "192.0.2.1"},
+		{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.2"},
+		{"name": "www", "type": "TXT", "ttl": 300, "data": "a"},
+	}
+	var listings [][]libdns.Record
+	for _, order := range [][]int{{0, 1, 2, 3}, {3, 2, 1, 0}, {2, 0, 3, 1}} {
+		f := newFakeMetaname(t, "example.com")
+		for _, i := range order {
+			rec := map[string]interface{}{}
+			for k, v := range raw[i] {
+				rec[k] = v
+			}
+			f.addRecord("example.com", rec)
+		}
+		records, err := f.provider().GetRecords(context.Background(), "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listings = append(listings, records)
+	}
+
+	want := []string{"api A 192.0.2.1", "www A 192.0.2.2", "www TXT a", "www TXT b"}
+	for _, records := range listings {
+		if len(records) != len(want) {
+			t.Fatalf("expected %d records; got %d", len(want), len(records))
+		}
+		for i, rec := range records {
+			if got := rec.Name + " " + rec.Type + " " + rec.Value; got != want[i] {
+				t.Fatalf("record %d: expected %q; got %q", i, want[i], got)
+			}
+		}
+	}
+}
+
+func TestForwardingEntriesListed(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "go", "type": "URL", "ttl": 300, "data": "https://example.net/"})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	p := f.provider()
+
+	records, err := p.GetCustomRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, rec := range records {
+		if rec.Name == "go" {
+			found = true
+			if rec.Metadata["forwarding"] != "web" {
+				t.Fatalf("expected forwarding entry to be marked as web forwarding; got %v", rec.Metadata)
+			}
+		} else if _, ok := rec.Metadata["forwarding"]; ok {
+			t.Fatalf("expected ordinary record not to be marked as forwarding; got %v", rec.Metadata)
+		}
+	}
+	if !found {
+		t.Fatal("expected forwarding entry in listing")
+	}
+
+	plain, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain) != 1 || plain[0].Name != "www" {
+		t.Fatalf("expected GetRecords to leave out the forwarding entry; got %+v", plain)
+	}
+	p.IncludeForwardingEntries = true
+	if plain, err = p.GetRecords(context.Background(), "example.com"); err != nil || len(plain) != 2 {
+		t.Fatalf("expected GetRecords to include the forwarding entry when asked; got %+v, %v", plain, err)
+	}
+
+	if _, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "go2", Type: "URL", Value: "https://example.net/"},
+	}); err == nil {
+		t.Fatal("expected writing a forwarding entry to be rejected")
+	}
+}
+
+func TestWithEndpoint(t *testing.T) {
+	first := newFakeMetaname(t, "example.com")
+	second := newFakeMetaname(t, "example.com")
+	second.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	p := first.provider()
+
+	records, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("expected the configured endpoint's empty zone; got %v", records)
+	}
+	records, err = p.GetRecords(WithEndpoint(context.Background(), second.server.URL), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected the overriding endpoint's zone; got %v", records)
+	}
+	if first.callCount("dns_zone") != 1 || second.callCount("dns_zone") != 1 {
+		t.Fatalf("expected one call to each endpoint; got %d and %d", first.callCount("dns_zone"), second.callCount("dns_zone"))
+	}
+}
+
+func TestEnvironmentEndpoint(t *testing.T) {
+	for env, want := range map[string]string{
+		"":           "https://metaname.net/api/1.1",
+		"production": "https://metaname.net/api/1.1",
+		"test":       "https://test.metaname.net/api/1.1",
+	} {
+		p := &Provider{Environment: env}
+		got, err := p.endpoint(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("expected environment %q to resolve to %s; got %s", env, want, got)
+		}
+	}
+
+	p := &Provider{Environment: "test", Endpoint: "http://localhost:8080"}
+	if got, _ := p.endpoint(context.Background()); got != p.Endpoint {
+		t.Fatalf("expected an explicit Endpoint to win; got %s", got)
+	}
+
+	p = &Provider{APIKey: "key", AccountReference: "ab12", Environment: "staging"}
+	if _, err := p.GetRecords(context.Background(), "example.com"); err == nil || !strings.Contains(err.Error(), "environment") {
+		t.Fatalf("expected an error for an unknown environment; got %v", err)
+	}
+}
+
+func TestConcurrentGetRecords(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	p := f.provider()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			records, err := p.GetRecords(context.Background(), "example.com")
+			if err == nil && len(records) != 1 {
+				err = fmt.Errorf("expected 1 record; got %v", records)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := f.callCount("dns_zone"); n != 20 {
+		t.Fatalf("expected 20 dns_zone calls; got %d", n)
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+	p.DefaultTTL = 15 * time.Minute
+
+	added, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1"},
+		{Name: "api", Type: "A", Value: "192.0.2.2", TTL: time.Minute},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added[0].TTL != 15*time.Minute || added[1].TTL != time.Minute {
+		t.Fatalf("expected the default only where no TTL was given; got %+v", added)
+	}
+	for _, rec := range f.records("example.com") {
+		want := float64(900)
+		if rec["name"] == "api" {
+			want = 60
+		}
+		if rec["ttl"] != want {
+			t.Fatalf("expected %s to be stored with TTL %v; got %v", rec["name"], want, rec["ttl"])
+		}
+	}
+}
+
+func TestDefaultTTLsByType(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+	p.DefaultTTL = time.Hour
+	p.DefaultTTLs = map[string]time.Duration{"TXT": time.Minute}
+
+	added, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "_acme-challenge", Type: "TXT", Value: "token"},
+		{Name: "www", Type: "A", Value: "192.0.2.1"},
+		{Name: "note", Type: "TXT", Value: "kept", TTL: 2 * time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added[0].TTL != time.Minute || added[1].TTL != time.Hour || added[2].TTL != 2*time.Hour {
+		t.Fatalf("expected the TXT default, the global default, and the given TTL; got %+v", added)
+	}
+}
+
+func TestBatchStopsWhenContextCancelled(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	creates := 0
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		if method == "create_dns_record" {
+			creates++
+			if creates == 2 {
+				// Cancel while the second create is in flight, and hold
+				// the response until the client has given up on it.
+				cancel()
+				time.Sleep(100 * time.Millisecond)
+				return true
+			}
+		}
+		return false
+	}
+	p := f.provider()
+
+	var records []libdns.Record
+	for i := 0; i < 5; i++ {
+		records = append(records, libdns.Record{Name: fmt.Sprintf("host%d", i), Type: "A", Value: "192.0.2.1"})
+	}
+	added, err := p.AppendRecords(ctx, "example.com", records)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a context error; got %v", err)
+	}
+	if len(added) != 1 || added[0].Name != "host0" {
+		t.Fatalf("expected only the first record to have been added; got %+v", added)
+	}
+	if n := f.callCount("create_dns_record"); n != 2 {
+		t.Fatalf("expected the batch to stop at the second create; got %d", n)
+	}
+}
+
+func TestCRUDAgainstLocalServer(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+	if !strings.HasPrefix(p.Endpoint, "http://") {
+		t.Fatalf("expected a plain http test server; got %s", p.Endpoint)
+	}
+	ctx := context.Background()
+
+	added, err := p.AppendRecords(ctx, "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := p.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != added[0].ID {
+		t.Fatalf("expected the added record to be listed; got %+v", records)
+	}
+
+	if _, err := p.SetRecords(ctx, "example.com", []libdns.Record{
+		{ID: added[0].ID, Name: "www", Type: "A", Value: "192.0.2.2", TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	records, err = p.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Value != "192.0.2.2" {
+		t.Fatalf("expected the record to be updated; got %+v", records)
+	}
+
+	deleted, err := p.DeleteRecords(ctx, "example.com", records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 {
+		t.Fatalf("expected 1 record deleted; got %+v", deleted)
+	}
+	if records, err = p.GetRecords(ctx, "example.com"); err != nil || len(records) != 0 {
+		t.Fatalf("expected an empty zone; got %+v, %v", records, err)
+	}
+}
+
+func TestAppendRecordsRejectsID(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	_, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{ID: "ref-from-elsewhere", Name: "www", Type: "A", Value: "192.0.2.1", TTL: time.Hour},
+	})
+	if err == nil || !strings.Contains(err.Error(), "assigns references") {
+		t.Fatalf("expected an error explaining references are server-assigned; got %v", err)
+	}
+	if n := f.callCount("create_dns_record"); n != 0 {
+		t.Fatalf("expected nothing to be created; got %d creates", n)
+	}
+}
+
+func TestMissingCredentials(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+	p.AccountReference = ""
+	if _, err := p.GetRecords(context.Background(), "example.com"); err == nil || !strings.Contains(err.Error(), "account reference required") {
+		t.Fatalf("expected an account reference error; got %v", err)
+	}
+	p = f.provider()
+	p.APIKey = ""
+	if err := p.Ping(context.Background()); err == nil || !strings.Contains(err.Error(), "API key required") {
+		t.Fatalf("expected an API key error; got %v", err)
+	}
+	if n := len(f.calls); n != 0 {
+		t.Fatalf("expected no API calls; got %v", f.calls)
+	}
+}
+
+func TestDeleteRecordsDuplicates(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	ref1 := f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	ref2 := f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 600, "data": "192.0.2.1"})
+	p := f.provider()
+
+	// One input record matching two stored duplicates removes both, and each
+	// removal is reported once, even when the input repeats the record.
+	rec := libdns.Record{Name: "www", Type: "A", Value: "192.0.2.1"}
+	deleted, err := p.DeleteRecords(context.Background(), "example.com", []libdns.Record{rec, rec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 2 || deleted[0].ID != ref1 || deleted[1].ID != ref2 {
+		t.Fatalf("expected both stored records reported by reference; got %+v", deleted)
+	}
+	if deleted[1].TTL != 600*time.Second {
+		t.Fatalf("expected the records as stored; got %+v", deleted[1])
+	}
+	if n := len(f.records("example.com")); n != 0 {
+		t.Fatalf("expected no records left; got %d", n)
+	}
+	if n := f.callCount("delete_dns_record"); n != 2 {
+		t.Fatalf("expected 2 delete calls; got %d", n)
+	}
+}
+
+func TestEveryTypeReadAndWritten(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	values := map[string]string{
+		"A":      "192.0.2.1",
+		"AAAA":   "2001:db8::1",
+		"CNAME":  "target.example.net.",
+		"MX":     "10 mail.example.com.",
+		"NS":     "ns1.example.net.",
+		"PTR":    "host.example.com.",
+		"SMIMEA": "3 0 1 C0A8E6A2D7CF1E2F",
+		"SRV":    "10 20 5060 sip.example.com.",
+		"TXT":    "hello",
+	}
+	var records []libdns.Record
+	for rtype := range supportedTypes {
+		value, ok := values[rtype]
+		if !ok {
+			t.Fatalf("no test value for supported type %s", rtype)
+		}
+		records = append(records, libdns.Record{Name: strings.ToLower(rtype), Type: rtype, Value: value, TTL: time.Hour})
+	}
+	if _, err := p.AppendRecords(context.Background(), "example.com", records); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != len(supportedTypes) {
+		t.Fatalf("expected %d records read back; got %+v", len(supportedTypes), read)
+	}
+	for _, rec := range read {
+		if rec.Name != strings.ToLower(rec.Type) || rec.Value != values[rec.Type] {
+			t.Fatalf("expected %s to read back as written; got %+v", rec.Type, rec)
+		}
+	}
+
+	deleted, err := p.DeleteRecords(context.Background(), "example.com", records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != len(records) || len(f.records("example.com")) != 0 {
+		t.Fatalf("expected every type deleted; deleted %d, %d left", len(deleted), len(f.records("example.com")))
+	}
+}
+
+func TestDNSKEYListed(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	key := "257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ=="
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "DNSKEY", "ttl": 3600, "data": key})
+	p := f.provider()
+
+	records, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Type != "DNSKEY" || records[0].Name != "" || records[0].Value != key {
+		t.Fatalf("expected the DNSKEY listed with its flags, protocol, algorithm, and key intact; got %+v", records)
+	}
+
+	// Reconciliation doesn't model DNSKEY, so it leaves the key alone.
+	if _, err := p.ApplyZone(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.callCount("delete_dns_record"); n != 0 {
+		t.Fatalf("expected the DNSKEY to be kept; got %d deletes", n)
+	}
+}
+
+func TestEmptyZoneAndMissingZone(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	records, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records == nil || len(records) != 0 {
+		t.Fatalf("expected an empty, non-nil list for an empty zone; got %#v", records)
+	}
+
+	if _, err := p.GetRecords(context.Background(), "example.org"); !errors.Is(err, ErrZoneNotFound) {
+		t.Fatalf("expected ErrZoneNotFound for a missing zone; got %v", err)
+	}
+
+	// A null result is an empty zone too, not a failure.
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		writeRPCResult(w, nil)
+		return true
+	}
+	records, err = p.GetRecords(context.Background(), "example.com")
+	if err != nil || records == nil || len(records) != 0 {
+		t.Fatalf("expected an empty, non-nil list for a null result; got %#v, %v", records, err)
+	}
+}
+
+func TestConnectionLimits(t *testing.T) {
+	p := &Provider{}
+	if p.requestClient() != http.DefaultClient {
+		t.Fatal("expected the default client without limits")
+	}
+
+	p = &Provider{MaxIdleConns: 10, MaxConnsPerHost: 20}
+	client := p.requestClient()
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("expected a transport of the Provider's own; got %T", client.Transport)
+	}
+	if transport.MaxIdleConns != 10 || transport.MaxIdleConnsPerHost != 10 || transport.MaxConnsPerHost != 20 {
+		t.Fatalf("expected the configured limits; got %d idle, %d idle per host, %d per host",
+			transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost)
+	}
+	if p.requestClient() != client {
+		t.Fatal("expected the same client to be reused")
+	}
+
+	injected := &http.Client{}
+	p = &Provider{HTTPClient: injected, MaxIdleConns: 10}
+	if p.requestClient() != injected {
+		t.Fatal("expected an injected client to be used as it is")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	ref := f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	p := f.provider()
+	p.ReadOnly = true
+	p.CheckZoneOwnership = true
+	ctx := context.Background()
+	rec := libdns.Record{Name: "www", Type: "A", Value: "192.0.2.2", TTL: time.Hour}
+
+	for name, change := range map[string]func() error{
+		"AppendRecords": func() error { _, err := p.AppendRecords(ctx, "example.com", []libdns.Record{rec}); return err },
+		"SetRecords":    func() error { _, err := p.SetRecords(ctx, "example.com", []libdns.Record{rec}); return err },
+		"DeleteRecords": func() error { _, err := p.DeleteRecords(ctx, "example.com", []libdns.Record{rec}); return err },
+		"ApplyZone":     func() error { _, err := p.ApplyZone(ctx, "example.com", []libdns.Record{rec}); return err },
+		"ReplaceRecord": func() error { _, err := p.ReplaceRecord(ctx, "example.com", rec, rec); return err },
+		"SetTTL":        func() error { _, err := p.SetTTL(ctx, "example.com", "www", "A", time.Hour); return err },
+		"DeleteRecordsByReference": func() error {
+			_, err := p.DeleteRecordsByReference(ctx, "example.com", []string{ref})
+			return err
+		},
+		"UpdateRecords": func() error {
+			_, err := p.UpdateRecords(ctx, "example.com", map[string]libdns.Record{ref: rec})
+			return err
+		},
+	} {
+		if err := change(); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("%s: expected ErrReadOnly; got %v", name, err)
+		}
+	}
+	if n := len(f.calls); n != 0 {
+		t.Fatalf("expected no API calls; got %d", n)
+	}
+
+	records, err := p.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Value != "192.0.2.1" {
+		t.Fatalf("expected the zone to be read as usual and left unchanged; got %+v", records)
+	}
+	if _, err := p.PlanZone(ctx, "example.com", []libdns.Record{rec}); err != nil {
+		t.Fatalf("expected planning, which changes nothing, to work; got %v", err)
+	}
+}
+
+func TestLowercaseTypesRead(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "alias", "type": "cname", "ttl": 300, "data": "www.example.com."})
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "Mx", "ttl": 300, "aux": 10, "data": "mail.example.com."})
+	p := f.provider()
+
+	records, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]string)
+	for _, rec := range records {
+		values[rec.Type] = rec.Value
+	}
+	if values["CNAME"] != "www.example.com." || values["MX"] != "10 mail.example.com." {
+		t.Fatalf("expected the types upper-cased and the MX preference restored; got %+v", records)
+	}
+
+	// They are matched as their upper-case selves too.
+	deleted, err := p.DeleteRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "alias", Type: "CNAME", Value: "www.example.com."},
+	})
+	if err != nil || len(deleted) != 1 {
+		t.Fatalf("expected the lowercase-typed CNAME to be deleted; got %d deleted, %v", len(deleted), err)
+	}
+}
+
+func TestRequestFormat(t *testing.T) {
+	var method, contentType, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, contentType, path = r.Method, r.Header.Get("Content-Type"), r.URL.Path
+		writeRPCResult(w, []interface{}{})
+	}))
+	defer server.Close()
+	p := &Provider{APIKey: "key", AccountReference: "ab12", Endpoint: server.URL}
+
+	if _, err := p.GetRecords(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPost || contentType != "application/json" || (path != "/" && path != "") {
+		t.Fatalf("expected a JSON POST to the endpoint; got %s %q to %q", method, contentType, path)
+	}
+
+	// A change to the format is made in one place and applies to every
+	// request.
+	saved := defaultRequestFormat
+	defer func() { defaultRequestFormat = saved }()
+	defaultRequestFormat = requestFormat{method: http.MethodPut, contentType: "application/json-rpc", path: "/v2"}
+	if _, err := p.GetRecords(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPut || contentType != "application/json-rpc" || path != "/v2" {
+		t.Fatalf("expected the overridden format; got %s %q to %q", method, contentType, path)
+	}
+}
@@ -0,0 +1,252 @@
+package metaname
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// RecordCounts returns how many records of each type the zone holds, keyed
+// by record type. Forwarding entries are counted only if
+// IncludeForwardingEntries is set, as GetRecords lists them.
+func (p *Provider) RecordCounts(ctx context.Context, zone string) (map[string]int, error) {
+	if err := validateZone(zone); err != nil {
+		return nil, err
+	}
+	metanameRecords, err := p.rpc().dns_zone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, rec := range metanameRecords {
+		if _, ok := forwardingTypes[rec.Type]; ok && !p.IncludeForwardingEntries {
+			continue
+		}
+		counts[rec.Type]++
+	}
+	return counts, nil
+}
+
+// GetRecordsByType returns the records in the zone of type rtype, in the
+// order GetRecords lists them. Metaname lists whole zones only, so this is
+// GetRecords filtered.
+func (p *Provider) GetRecordsByType(ctx context.Context, zone, rtype string) ([]libdns.Record, error) {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	rtype = strings.ToUpper(rtype)
+	var matching []libdns.Record
+	for _, rec := range records {
+		if rec.Type == rtype {
+			matching = append(matching, rec)
+		}
+	}
+	return matching, nil
+}
+
+// GetRecordsUnder returns the records in the zone named subdomain or any
+// name beneath it, in the order GetRecords lists them. The subdomain may be
+// given relative to the zone or fully qualified, and is matched without
+// regard to case; the apex, "" or "@", gives the whole zone.
+func (p *Provider) GetRecordsUnder(ctx context.Context, zone, subdomain string) ([]libdns.Record, error) {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	subdomain = strings.ToLower(relativeName(subdomain, zone))
+	if subdomain == "" {
+		return records, nil
+	}
+	var under []libdns.Record
+	for _, rec := range records {
+		name := strings.ToLower(rec.Name)
+		if name == subdomain || strings.HasSuffix(name, "."+subdomain) {
+			under = append(under, rec)
+		}
+	}
+	return under, nil
+}
+
+// GetRecordsGrouped returns the zone's records keyed by their names,
+// relative to the zone with "" for the apex. Names are matched without
+// regard to case and keyed in lower case. Each name's records are in the
+// order GetRecords lists them.
+func (p *Provider) GetRecordsGrouped(ctx context.Context, zone string) (map[string][]libdns.Record, error) {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string][]libdns.Record)
+	for _, rec := range records {
+		name := strings.ToLower(rec.Name)
+		groups[name] = append(groups[name], rec)
+	}
+	return groups, nil
+}
+
+// GetRecordsPage returns at most limit of the zone's records, starting at
+// offset in the order GetRecords lists them, along with how many records
+// the zone holds in all. Metaname lists whole zones only, so the paging is
+// done here over the full listing; an offset past the end gives no records.
+func (p *Provider) GetRecordsPage(ctx context.Context, zone string, offset, limit int) ([]libdns.Record, int, error) {
+	if offset < 0 || limit <= 0 {
+		return nil, 0, fmt.Errorf("invalid page: offset %d, limit %d", offset, limit)
+	}
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return nil, 0, err
+	}
+	total := len(records)
+	if offset >= total {
+		return nil, total, nil
+	}
+	end := offset + limit
+	if end > total || end < offset {
+		end = total
+	}
+	return records[offset:end], total, nil
+}
+
+// ZoneSerial returns the serial number of the zone's SOA record, which
+// Metaname increases when the zone changes, so that a caller can confirm a
+// change registered before watching for it to propagate. It always reads
+// the zone afresh, whatever the cache holds.
+func (p *Provider) ZoneSerial(ctx context.Context, zone string) (uint32, error) {
+	if err := validateZone(zone); err != nil {
+		return 0, err
+	}
+	records, err := p.rpc().dns_zone(WithoutCache(ctx), zone)
+	if err != nil {
+		return 0, err
+	}
+	for _, rec := range records {
+		if !strings.EqualFold(rec.Type, "SOA") {
+			continue
+		}
+		// mname rname serial refresh retry expire minimum
+		fields := strings.Fields(rec.Data)
+		if len(fields) < 3 {
+			return 0, fmt.Errorf("malformed SOA record in %s: %q", zone, rec.Data)
+		}
+		serial, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("malformed SOA serial in %s: %q", zone, fields[2])
+		}
+		return uint32(serial), nil
+	}
+	return 0, fmt.Errorf("no SOA record in %s", zone)
+}
+
+// FindDuplicates returns the groups of records in the zone that share the
+// same name, type, and value, ignoring TTL and matching names and values as
+// DeleteRecords does. Records without a duplicate aren't included.
+func (p *Provider) FindDuplicates(ctx context.Context, zone string) ([][]libdns.Record, error) {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups [][]libdns.Record
+	for _, rec := range records {
+		found := false
+		for i, group := range groups {
+			if recordsMatch(group[0], rec) {
+				groups[i] = append(group, rec)
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, []libdns.Record{rec})
+		}
+	}
+
+	var duplicates [][]libdns.Record
+	for _, group := range groups {
+		if len(group) > 1 {
+			duplicates = append(duplicates, group)
+		}
+	}
+	return duplicates, nil
+}
+
+// FindDanglingCNAMEs returns the CNAME records in the zone whose targets
+// lie within the zone but have no record of their own, in the order
+// GetRecords lists them. A target covered by a wildcard, or beneath a
+// subdomain delegated with NS records, isn't counted as dangling, and
+// targets outside the zone aren't checked. Nothing is changed.
+func (p *Provider) FindDanglingCNAMEs(ctx context.Context, zone string) ([]libdns.Record, error) {
+	records, err := p.GetCustomRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	delegated := make(map[string]bool)
+	for _, rec := range records {
+		name := strings.ToLower(rec.Name)
+		names[name] = true
+		if rec.Type == "NS" && name != "" {
+			delegated[name] = true
+		}
+	}
+	resolves := func(target string) bool {
+		if names[target] || delegated[target] {
+			return true
+		}
+		for parent := target; parent != ""; {
+			i := strings.Index(parent, ".")
+			if i < 0 {
+				parent = ""
+			} else {
+				parent = parent[i+1:]
+			}
+			if delegated[parent] || names[strings.TrimSuffix("*."+parent, ".")] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var dangling []libdns.Record
+	for _, rec := range records {
+		if rec.Type != "CNAME" {
+			continue
+		}
+		target := rec.Value
+		if target == "@" {
+			target = ""
+		} else if strings.HasSuffix(target, ".") {
+			target = relativeName(target, zone)
+			if strings.HasSuffix(target, ".") {
+				continue // outside the zone
+			}
+		}
+		if !resolves(strings.ToLower(target)) {
+			dangling = append(dangling, rec.Unwrap())
+		}
+	}
+	return dangling, nil
+}
+
+// GetNameservers returns the zone's authoritative nameservers, taken from
+// its apex NS records, as fully qualified hostnames without a trailing dot
+// in the order GetRecords lists them.
+func (p *Provider) GetNameservers(ctx context.Context, zone string) ([]string, error) {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	var nameservers []string
+	for _, rec := range records {
+		if rec.Name == "" && rec.Type == "NS" {
+			nameservers = append(nameservers, strings.TrimSuffix(rec.Value, "."))
+		}
+	}
+	return nameservers, nil
+}
@@ -0,0 +1,270 @@
+package metaname
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestRecordCounts(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.2"})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "TXT", "ttl": 300, "data": "hello"})
+	f.addRecord("example.com", map[string]interface{}{"name": "", "type": "MX", "ttl": 300, "aux": 10, "data": "mail.example.com."})
+	p := f.provider()
+
+	counts, err := p.RecordCounts(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 3 || counts["A"] != 2 || counts["TXT"] != 1 || counts["MX"] != 1 {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+
+	// Forwarding entries are counted only where GetRecords would list them.
+	f.addRecord("example.com", map[string]interface{}{"name": "fwd", "type": "URL", "ttl": 300, "data": "http://example.net/"})
+	if counts, err = p.RecordCounts(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := counts["URL"]; ok {
+		t.Fatalf("expected the forwarding entry left out; got %v", counts)
+	}
+	p.IncludeForwardingEntries = true
+	if counts, err = p.RecordCounts(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if counts["URL"] != 1 {
+		t.Fatalf("expected the forwarding entry counted; got %v", counts)
+	}
+}
+
+func TestGetRecordsByType(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "TXT", "ttl": 300, "data": "hello"})
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "TXT", "ttl": 300, "data": "v=spf1 -all"})
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "MX", "ttl": 300, "aux": 10, "data": "mail.example.com."})
+	p := f.provider()
+
+	records, err := p.GetRecordsByType(context.Background(), "example.com", "txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected the 2 TXT records; got %+v", records)
+	}
+	for _, rec := range records {
+		if rec.Type != "TXT" {
+			t.Fatalf("expected only TXT records; got %+v", rec)
+		}
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 600, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.2"})
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "TXT", "ttl": 300, "data": "x"})
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "TXT", "ttl": 300, "data": "x"})
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "TXT", "ttl": 300, "data": "x"})
+	f.addRecord("example.com", map[string]interface{}{"name": "v6", "type": "AAAA", "ttl": 300, "data": "2001:db8::1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "V6", "type": "AAAA", "ttl": 300, "data": "2001:0db8:0000:0000:0000:0000:0000:0001"})
+	p := f.provider()
+
+	groups, err := p.FindDuplicates(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 duplicate groups; got %v", groups)
+	}
+	if len(groups[0]) != 3 || groups[0][0].Type != "TXT" {
+		t.Fatalf("expected the three apex TXT records grouped first; got %v", groups[0])
+	}
+	if len(groups[1]) != 2 || groups[1][0].Type != "AAAA" {
+		t.Fatalf("expected the v6 addresses grouped despite case and compression; got %v", groups[1])
+	}
+	if len(groups[2]) != 2 || groups[2][0].Value != "192.0.2.1" || groups[2][0].ID == groups[2][1].ID {
+		t.Fatalf("expected the two distinct www A 192.0.2.1 records grouped; got %v", groups[2])
+	}
+}
+
+func TestFindDanglingCNAMEs(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "*.dev", "type": "A", "ttl": 300, "data": "192.0.2.2"})
+	f.addRecord("example.com", map[string]interface{}{"name": "sub", "type": "NS", "ttl": 86400, "data": "ns.elsewhere.net."})
+	f.addRecord("example.com", map[string]interface{}{"name": "alias", "type": "CNAME", "ttl": 300, "data": "www.example.com."})
+	f.addRecord("example.com", map[string]interface{}{"name": "short", "type": "CNAME", "ttl": 300, "data": "www"})
+	f.addRecord("example.com", map[string]interface{}{"name": "app", "type": "CNAME", "ttl": 300, "data": "feature.dev.example.com."})
+	f.addRecord("example.com", map[string]interface{}{"name": "host", "type": "CNAME", "ttl": 300, "data": "api.sub.example.com."})
+	f.addRecord("example.com", map[string]interface{}{"name": "away", "type": "CNAME", "ttl": 300, "data": "gone.example.net."})
+	f.addRecord("example.com", map[string]interface{}{"name": "old", "type": "CNAME", "ttl": 300, "data": "retired.example.com."})
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "A", "ttl": 300, "data": "192.0.2.3"})
+	f.addRecord("example.com", map[string]interface{}{"name": "apex", "type": "CNAME", "ttl": 300, "data": "@"})
+	p := f.provider()
+
+	dangling, err := p.FindDanglingCNAMEs(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dangling) != 1 || dangling[0].Name != "old" || dangling[0].Value != "retired.example.com." {
+		t.Fatalf("expected only old to be reported as dangling; got %+v", dangling)
+	}
+	if n := f.callCount("create_dns_record") + f.callCount("update_dns_record") + f.callCount("delete_dns_record"); n != 0 {
+		t.Fatalf("expected no changes to the zone; got %d", n)
+	}
+}
+
+func TestGetNameservers(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "NS", "ttl": 86400, "data": "ns2.metaname.net."})
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "NS", "ttl": 86400, "data": "ns1.metaname.net."})
+	f.addRecord("example.com", map[string]interface{}{"name": "sub", "type": "NS", "ttl": 86400, "data": "ns.elsewhere.net."})
+	p := f.provider()
+
+	nameservers, err := p.GetNameservers(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nameservers) != 2 || nameservers[0] != "ns1.metaname.net" || nameservers[1] != "ns2.metaname.net" {
+		t.Fatalf("expected the two apex nameservers; got %v", nameservers)
+	}
+}
+
+func TestGetRecordsPage(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	for i := 0; i < 5; i++ {
+		f.addRecord("example.com", map[string]interface{}{"name": fmt.Sprintf("host%d", i), "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	}
+	p := f.provider()
+
+	for _, tc := range []struct {
+		offset, limit int
+		want          []string
+	}{
+		{0, 2, []string{"host0", "host1"}},
+		{3, 2, []string{"host3", "host4"}},
+		{4, 10, []string{"host4"}},
+		{5, 2, nil},
+	} {
+		page, total, err := p.GetRecordsPage(context.Background(), "example.com", tc.offset, tc.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 5 {
+			t.Fatalf("expected a total of 5; got %d", total)
+		}
+		var names []string
+		for _, rec := range page {
+			names = append(names, rec.Name)
+		}
+		if !reflect.DeepEqual(names, tc.want) {
+			t.Fatalf("offset %d, limit %d: expected %v; got %v", tc.offset, tc.limit, tc.want, names)
+		}
+	}
+
+	if _, _, err := p.GetRecordsPage(context.Background(), "example.com", -1, 2); err == nil {
+		t.Fatal("expected a negative offset to be rejected")
+	}
+	if _, _, err := p.GetRecordsPage(context.Background(), "example.com", 0, 0); err == nil {
+		t.Fatal("expected a zero limit to be rejected")
+	}
+}
+
+func TestGetRecordsUnder(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	for _, name := range []string{"dev", "api.dev", "x.API.Dev", "devices", "www", "@", "dev.www"} {
+		f.addRecord("example.com", map[string]interface{}{"name": name, "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	}
+	p := f.provider()
+
+	for _, subdomain := range []string{"dev", "DEV", "dev.example.com."} {
+		records, err := p.GetRecordsUnder(context.Background(), "example.com", subdomain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, rec := range records {
+			names = append(names, rec.Name)
+		}
+		if want := []string{"api.dev", "dev", "x.API.Dev"}; !reflect.DeepEqual(names, want) {
+			t.Fatalf("%s: expected %v; got %v", subdomain, want, names)
+		}
+	}
+
+	records, err := p.GetRecordsUnder(context.Background(), "example.com", "@")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 7 {
+		t.Fatalf("expected the apex to give the whole zone; got %d records", len(records))
+	}
+}
+
+func TestZoneSerial(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "SOA", "ttl": 3600, "data": "ns1.metaname.net. hostmaster.metaname.net. 2024010101 3600 900 604800 300"})
+	p := f.provider()
+	p.CacheTTL = time.Hour
+
+	before, err := p.ZoneSerial(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != 2024010101 {
+		t.Fatalf("expected serial 2024010101; got %d", before)
+	}
+	if _, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	after, err := p.ZoneSerial(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after <= before {
+		t.Fatalf("expected the serial to increase after a change; got %d then %d", before, after)
+	}
+
+	empty := newFakeMetaname(t, "example.org")
+	if _, err := empty.provider().ZoneSerial(context.Background(), "example.org"); err == nil {
+		t.Fatal("expected an error for a zone with no SOA record")
+	}
+}
+
+func TestGetRecordsGrouped(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "AAAA", "ttl": 300, "data": "2001:db8::1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "TXT", "ttl": 300, "data": "v=spf1 -all"})
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "MX", "ttl": 300, "aux": 10, "data": "mail.example.com."})
+	f.addRecord("example.com", map[string]interface{}{"name": "mail", "type": "A", "ttl": 300, "data": "192.0.2.2"})
+	f.addRecord("example.com", map[string]interface{}{"name": "WWW", "type": "TXT", "ttl": 300, "data": "web"})
+	p := f.provider()
+
+	groups, err := p.GetRecordsGrouped(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for name, records := range groups {
+		for _, rec := range records {
+			if !strings.EqualFold(rec.Name, name) {
+				t.Fatalf("expected only records named %q under %q; got %+v", name, name, rec)
+			}
+		}
+		counts[name] = len(records)
+	}
+	if want := map[string]int{"": 2, "www": 3, "mail": 1}; !reflect.DeepEqual(counts, want) {
+		t.Fatalf("expected groups %v; got %v", want, counts)
+	}
+}
@@ -0,0 +1,240 @@
+package metaname
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// retryBaseDelay is the delay before the first retry; it doubles with each
+// subsequent attempt unless Metaname asks for a specific delay.
+var retryBaseDelay = 500 * time.Millisecond
+
+// defaultMaxRetryDelay caps the delay before any one retry when the
+// Provider's MaxRetryDelay isn't set.
+const defaultMaxRetryDelay = 30 * time.Second
+
+// retryDelay returns how long to wait before retrying after the given
+// failed attempt. A delay requested by Metaname takes precedence over our
+// own exponential backoff, but both are capped by MaxRetryDelay.
+func (p *Provider) retryDelay(attempt int, err error) time.Duration {
+	limit := p.MaxRetryDelay
+	if limit <= 0 {
+		limit = defaultMaxRetryDelay
+	}
+	delay := limit
+	if attempt < 32 {
+		if d := retryBaseDelay << attempt; d > 0 && d < limit {
+			delay = d
+		}
+	}
+	if rl, ok := err.(*rateLimitError); ok && rl.retryAfter > 0 {
+		delay = rl.retryAfter
+	}
+	if ue, ok := err.(*unavailableError); ok && ue.retryAfter > 0 {
+		delay = ue.retryAfter
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+// rateLimitError reports that Metaname refused a request for exceeding its
+// rate limit. retryAfter is the delay Metaname asked for, or zero if it
+// didn't give one.
+type rateLimitError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	if e.retryAfter > 0 {
+		return "Metaname rate limit exceeded (retry after " + e.retryAfter.String() + ")"
+	}
+	return "Metaname rate limit exceeded"
+}
+
+// unavailableError reports that Metaname is temporarily unavailable, with
+// the delay it asked for, if any, and the message it gave, if any. It
+// unwraps to ErrTemporarilyUnavailable.
+type unavailableError struct {
+	retryAfter time.Duration
+	msg        string
+}
+
+func (e *unavailableError) Error() string {
+	if e.msg != "" {
+		return ErrTemporarilyUnavailable.Error() + ": " + e.msg
+	}
+	return ErrTemporarilyUnavailable.Error()
+}
+
+func (e *unavailableError) Unwrap() error {
+	return ErrTemporarilyUnavailable
+}
+
+// transportError wraps a failure to complete the HTTP exchange at all, as
+// opposed to an error reported by Metaname.
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string {
+	return "error performing http request: " + e.err.Error()
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+// defaultReadRetries is how many times a read-only request is retried after
+// a transient failure even when MaxRetries is zero. Metaname occasionally
+// fails perfectly good requests, and a read is always safe to repeat.
+const defaultReadRetries = 2
+
+// readOnlyMethods are the Metaname methods that change nothing.
+var readOnlyMethods = map[string]bool{
+	"dns_zone":        true,
+	"domain_names":    true,
+	"account_balance": true,
+}
+
+// isTransient reports whether a failed attempt looks like one of Metaname's
+// occasional spurious failures: a transport failure, or its bare "Internal
+// error" response. Rate-limit and maintenance responses call for waiting,
+// which is left to MaxRetries.
+func isTransient(ctx context.Context, err error, response *metanameResponse) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err == nil {
+		return response.Error.Code != 0 && strings.EqualFold(strings.TrimSpace(response.Error.Message), "internal error")
+	}
+	_, ok := err.(*transportError)
+	return ok
+}
+
+// unrepeatableMethods are the Metaname methods that can't safely be sent
+// twice: a create that reached Metaname before the connection failed would
+// be made again, giving a duplicate record.
+var unrepeatableMethods = map[string]bool{
+	"create_dns_record": true,
+}
+
+// isRetryable reports whether a failed request for method may be attempted
+// again. Rate-limit and maintenance responses are retryable, since Metaname
+// refused the request rather than carrying it out. Transport failures are
+// retryable too, except for unrepeatableMethods, since the request may have
+// been carried out before the failure. A cancelled or expired context is
+// never retried.
+func isRetryable(ctx context.Context, method string, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if _, ok := err.(*rateLimitError); ok {
+		return true
+	}
+	if _, ok := err.(*unavailableError); ok {
+		return true
+	}
+	_, ok := err.(*transportError)
+	return ok && !unrepeatableMethods[method]
+}
+
+// isRateLimitMessage reports whether a JSON-RPC error message indicates the
+// request was rejected for exceeding the rate limit.
+func isRateLimitMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	return strings.Contains(msg, "rate limit") || strings.Contains(msg, "too many requests")
+}
+
+// parseRetryAfter reads an HTTP Retry-After header, which may be either a
+// number of seconds or an HTTP date. It returns zero if there is no usable
+// value.
+func parseRetryAfter(header string) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// retryAfterFromData reads a retry_after hint, in seconds, from the data
+// field of a JSON-RPC error.
+func retryAfterFromData(data interface{}) time.Duration {
+	fields, ok := data.(map[string]interface{})
+	if !ok {
+		return 0
+	}
+	switch v := fields["retry_after"].(type) {
+	case float64:
+		if v > 0 {
+			return time.Duration(v * float64(time.Second))
+		}
+	case string:
+		return parseRetryAfter(v)
+	}
+	return 0
+}
+
+// rateLimitState is the rate-limit state reported with a response.
+type rateLimitState struct {
+	reported  bool
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// noteRateLimit records the rate-limit state in header, if it has any.
+func (p *Provider) noteRateLimit(header http.Header) {
+	limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return
+	}
+	rl := rateLimitState{reported: true, limit: limit}
+	rl.remaining, _ = strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		rl.reset = time.Unix(reset, 0)
+	}
+	p.usageMutex.Lock()
+	p.rateLimit = rl
+	p.usageMutex.Unlock()
+}
+
+// retryBudgetKey is the context key for the retries left to a batch.
+type retryBudgetKey struct{}
+
+// withRetryBudget returns ctx carrying a budget of MaxBatchRetries retries
+// for a batch operation to share among its requests. A batch started
+// within another shares the outer batch's budget.
+func (p *Provider) withRetryBudget(ctx context.Context) context.Context {
+	if p.MaxBatchRetries <= 0 || ctx.Value(retryBudgetKey{}) != nil {
+		return ctx
+	}
+	remaining := int64(p.MaxBatchRetries)
+	return context.WithValue(ctx, retryBudgetKey{}, &remaining)
+}
+
+// takeRetry uses up one retry from the budget in ctx, reporting whether
+// there was one to use. Without a budget, retries are unlimited.
+func takeRetry(ctx context.Context) bool {
+	remaining, ok := ctx.Value(retryBudgetKey{}).(*int64)
+	if !ok {
+		return true
+	}
+	return atomic.AddInt64(remaining, -1) >= 0
+}
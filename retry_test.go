@@ -0,0 +1,328 @@
+package metaname
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	limited := false
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		if limited {
+			return false
+		}
+		limited = true
+		writeRPCErrorData(w, -32000, "Rate limit exceeded", map[string]interface{}{"retry_after": 2})
+		return true
+	}
+	p := f.provider()
+	p.MaxRetries = 1
+
+	start := time.Now()
+	if _, err := p.GetRecords(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	if elapsed < 2*time.Second || elapsed > 3*time.Second {
+		t.Fatalf("expected to wait about 2s before retrying; waited %s", elapsed)
+	}
+	if n := f.callCount("dns_zone"); n != 2 {
+		t.Fatalf("expected 2 dns_zone calls; got %d", n)
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	limited := false
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		if limited {
+			return false
+		}
+		limited = true
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+		return true
+	}
+	p := f.provider()
+	p.MaxRetries = 1
+
+	start := time.Now()
+	if _, err := p.GetRecords(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("expected to wait at least 1s before retrying; waited %s", elapsed)
+	}
+}
+
+func TestRetryRespectsMaxRetriesAndContext(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		writeRPCErrorData(w, -32000, "Rate limit exceeded", map[string]interface{}{"retry_after": 5})
+		return true
+	}
+	p := f.provider()
+
+	// With retries disabled the rate-limit error is returned immediately.
+	if _, err := p.GetRecords(context.Background(), "example.com"); err == nil {
+		t.Fatal("expected rate-limit error")
+	}
+	if n := f.callCount("dns_zone"); n != 1 {
+		t.Fatalf("expected 1 dns_zone call; got %d", n)
+	}
+
+	// A context deadline shorter than the requested delay cuts the wait short.
+	p.MaxRetries = 3
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := p.GetRecords(ctx, "example.com"); err == nil {
+		t.Fatal("expected context error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected context to end the wait promptly; waited %s", elapsed)
+	}
+}
+
+func TestRetryTotalDeadline(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		w.WriteHeader(http.StatusTooManyRequests)
+		return true
+	}
+	p := f.provider()
+	p.MaxRetries = 100
+	p.MaxRetryDuration = time.Second
+
+	start := time.Now()
+	if _, err := p.GetRecords(context.Background(), "example.com"); err == nil {
+		t.Fatal("expected error from perpetually failing endpoint")
+	}
+	if elapsed := time.Since(start); elapsed > p.MaxRetryDuration {
+		t.Fatalf("expected to give up within %s; took %s", p.MaxRetryDuration, elapsed)
+	}
+	if n := f.callCount("dns_zone"); n < 2 {
+		t.Fatalf("expected at least one retry; got %d calls", n)
+	}
+}
+
+func TestRetryDelayCap(t *testing.T) {
+	p := &Provider{MaxRetryDelay: time.Second}
+	if d := p.retryDelay(10, &rateLimitError{}); d != time.Second {
+		t.Fatalf("expected backoff to be capped at 1s; got %s", d)
+	}
+	if d := p.retryDelay(0, &rateLimitError{retryAfter: time.Minute}); d != time.Second {
+		t.Fatalf("expected requested delay to be capped at 1s; got %s", d)
+	}
+	if d := p.retryDelay(0, &rateLimitError{}); d != retryBaseDelay {
+		t.Fatalf("expected first backoff of %s; got %s", retryBaseDelay, d)
+	}
+}
+
+func TestBatchResumesAfterRateLimit(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	creates := 0
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		if method != "create_dns_record" {
+			return false
+		}
+		creates++
+		if creates != 10 {
+			return false
+		}
+		writeRPCErrorData(w, -32000, "Rate limit exceeded", map[string]interface{}{"retry_after": 0.05})
+		return true
+	}
+	p := f.provider()
+	p.MaxRetries = 1
+
+	var records []libdns.Record
+	for i := 0; i < 50; i++ {
+		records = append(records, libdns.Record{Name: fmt.Sprintf("host%d", i), Type: "A", Value: "192.0.2.1", TTL: time.Hour})
+	}
+	added, err := p.AppendRecords(context.Background(), "example.com", records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 50 {
+		t.Fatalf("expected all 50 records added; got %d", len(added))
+	}
+	if n := len(f.records("example.com")); n != 50 {
+		t.Fatalf("expected 50 records stored; got %d", n)
+	}
+	if creates != 51 {
+		t.Fatalf("expected 51 create calls including the retry; got %d", creates)
+	}
+}
+
+func TestMaintenanceIsRetriedAndSurfaced(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	down := 1
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		if down == 0 {
+			return false
+		}
+		down--
+		writeRPCError(w, -32000, "System under maintenance, please try again later")
+		return true
+	}
+	p := f.provider()
+
+	// Without retries the maintenance response is reported as such.
+	_, err := p.GetRecords(context.Background(), "example.com")
+	if !errors.Is(err, ErrTemporarilyUnavailable) {
+		t.Fatalf("expected ErrTemporarilyUnavailable; got %v", err)
+	}
+
+	// With retries it is waited out.
+	down = 1
+	p.MaxRetries = 1
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = 10 * time.Millisecond
+	if _, err := p.GetRecords(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.callCount("dns_zone"); n != 3 {
+		t.Fatalf("expected 3 dns_zone calls; got %d", n)
+	}
+
+	// An HTTP 503 is treated the same way.
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return true
+	}
+	p.MaxRetries = 0
+	if _, err := p.GetRecords(context.Background(), "example.com"); !errors.Is(err, ErrTemporarilyUnavailable) {
+		t.Fatalf("expected ErrTemporarilyUnavailable for HTTP 503; got %v", err)
+	}
+}
+
+func TestReadsRetriedByDefault(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	failures := 1
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		if failures == 0 {
+			return false
+		}
+		failures--
+		writeRPCError(w, -32000, "Internal error")
+		return true
+	}
+	p := f.provider()
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = 10 * time.Millisecond
+
+	records, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected the record after the retry; got %+v", records)
+	}
+	if n := f.callCount("dns_zone"); n != 2 {
+		t.Fatalf("expected 2 dns_zone calls; got %d", n)
+	}
+
+	// Writes aren't retried without MaxRetries, and reads give up in time.
+	failures = 1
+	if _, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "mail", Type: "A", Value: "192.0.2.2", TTL: time.Hour},
+	}); err == nil {
+		t.Fatal("expected the failed create to be reported")
+	}
+	failures = 10
+	if _, err := p.GetRecords(context.Background(), "example.com"); err == nil {
+		t.Fatal("expected a persistent failure to be reported")
+	}
+	if n := f.callCount("dns_zone"); n != 2+1+defaultReadRetries {
+		t.Fatalf("expected %d retries for the persistent failure; got %d calls in all", defaultReadRetries, n)
+	}
+}
+
+func TestBatchRetryBudget(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	// Every record's first create attempt is rate limited.
+	limited := make(map[string]bool)
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		if method != "create_dns_record" {
+			return false
+		}
+		var rec struct{ Name string }
+		json.Unmarshal(params[3], &rec)
+		if limited[rec.Name] {
+			return false
+		}
+		limited[rec.Name] = true
+		writeRPCErrorData(w, -32000, "Rate limit exceeded", map[string]interface{}{"retry_after": 0.01})
+		return true
+	}
+	p := f.provider()
+	p.MaxRetries = 5
+	p.MaxBatchRetries = 3
+
+	var records []libdns.Record
+	for i := 0; i < 10; i++ {
+		records = append(records, libdns.Record{Name: fmt.Sprintf("host%d", i), Type: "A", Value: "192.0.2.1", TTL: time.Hour})
+	}
+	added, err := p.AppendRecords(context.Background(), "example.com", records)
+	if err == nil {
+		t.Fatal("expected the batch to fail once its retries were used up")
+	}
+	// The first three records use up the budget between them, so the
+	// fourth isn't retried.
+	if len(added) != 3 {
+		t.Fatalf("expected 3 records added; got %d", len(added))
+	}
+	if n := f.callCount("create_dns_record"); n != 7 {
+		t.Fatalf("expected 7 create calls; got %d", n)
+	}
+
+	// Each batch gets a budget of its own.
+	if _, err := p.AppendRecords(context.Background(), "example.com", records[4:5]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateNotRetriedAfterTransportFailure(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.intercept = func(w http.ResponseWriter, method string, params []json.RawMessage) bool {
+		if method != "create_dns_record" {
+			return false
+		}
+		// The record is created, but the connection drops before the
+		// response is written.
+		f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 3600, "data": "192.0.2.1"})
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	p := f.provider()
+	p.MaxRetries = 3
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = 10 * time.Millisecond
+
+	if _, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: time.Hour},
+	}); err == nil {
+		t.Fatal("expected the transport failure to be reported")
+	}
+	if n := f.callCount("create_dns_record"); n != 1 {
+		t.Fatalf("expected the create not to be repeated; got %d create calls", n)
+	}
+	if n := len(f.records("example.com")); n != 1 {
+		t.Fatalf("expected no duplicate record; got %d records", n)
+	}
+}
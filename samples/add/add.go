@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/libdns/libdns"
@@ -13,21 +15,22 @@ import (
 func main() {
 	if len(os.Args) < 5 {
 		fmt.Println("Usage: ", os.Args[0], "<zone>", "<name>", "<type>", "<value>")
+		fmt.Println("A type of auto picks A, AAAA, CNAME, or TXT to suit the value.")
 		os.Exit(1)
 	}
 	ctx := context.TODO()
-	endpoint := "https://test.metaname.net/api/1.1"
-	val, ok := os.LookupEnv("api_endpoint")
-	if ok {
-		endpoint = val
-	}
 	provider := metaname.Provider{APIKey: os.Getenv("api_key"),
 		AccountReference: os.Getenv("account_reference"),
-		Endpoint:         endpoint}
+		Environment:      "test",
+		Endpoint:         os.Getenv("api_endpoint")}
 	zone := os.Args[1]
 	name := os.Args[2]
 	rtype := os.Args[3]
 	value := os.Args[4]
+	if strings.EqualFold(rtype, "auto") {
+		rtype = inferType(value)
+		fmt.Println("Type:", rtype)
+	}
 	added, err := provider.AppendRecords(ctx, zone, []libdns.Record{
 		{
 			Name:  name,
@@ -38,7 +41,44 @@ func main() {
 	})
 	if err != nil {
 		fmt.Println(err)
+		os.Exit(1)
 	}
 	newone := added[0]
 	fmt.Println("Reference:", newone.ID)
 }
+
+// inferType picks a record type for value: A or AAAA for an address of
+// that family, CNAME for something that looks like a hostname, and TXT for
+// anything else.
+func inferType(value string) string {
+	if ip := net.ParseIP(value); ip != nil {
+		if ip.To4() != nil {
+			return "A"
+		}
+		return "AAAA"
+	}
+	if isHostname(value) {
+		return "CNAME"
+	}
+	return "TXT"
+}
+
+// isHostname reports whether value is a multi-label hostname, optionally
+// fully qualified with a trailing dot.
+func isHostname(value string) bool {
+	labels := strings.Split(strings.TrimSuffix(value, "."), ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
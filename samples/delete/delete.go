@@ -15,14 +15,10 @@ func main() {
 		os.Exit(1)
 	}
 	ctx := context.TODO()
-	endpoint := "https://test.metaname.net/api/1.1"
-	val, ok := os.LookupEnv("api_endpoint")
-	if ok {
-		endpoint = val
-	}
 	provider := metaname.Provider{APIKey: os.Getenv("api_key"),
 		AccountReference: os.Getenv("account_reference"),
-		Endpoint:         endpoint}
+		Environment:      "test",
+		Endpoint:         os.Getenv("api_endpoint")}
 	zone := os.Args[1]
 	_, err := provider.DeleteRecords(ctx, zone, []libdns.Record{
 		{ID: os.Args[2]},
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/libdns/libdns"
@@ -20,12 +21,12 @@ func main() {
 		fmt.Println("Other records created/changed are 'test' and 'additional'.")
 		os.Exit(1)
 	}
-	endpoint := "https://test.metaname.net/api/1.1"
 	provider := metaname.Provider{APIKey: os.Getenv("api_key"),
 		AccountReference: os.Getenv("account_reference"),
-		Endpoint:         endpoint}
+		Environment:      "test"}
 	zone := os.Args[1]
 	recs, _ := provider.GetRecords(ctx, zone)
+	sortForDisplay(recs)
 	for _, r := range recs {
 		fmt.Println("found", r.Name, r.Type, r.Value)
 	}
@@ -72,3 +73,15 @@ func main() {
 		fmt.Println("updated", r.Name, r.Type, r.Value)
 	}
 }
+
+// sortForDisplay orders records by type, then name, so that output is
+// grouped by type and stable between runs. GetRecords already orders
+// records with the same type and name by value.
+func sortForDisplay(records []libdns.Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Type != records[j].Type {
+			return records[i].Type < records[j].Type
+		}
+		return records[i].Name < records[j].Name
+	})
+}
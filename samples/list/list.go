@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sort"
 
+	"github.com/libdns/libdns"
 	"github.com/libdns/metaname"
 )
 
@@ -14,21 +16,31 @@ func main() {
 		os.Exit(1)
 	}
 	ctx := context.TODO()
-	endpoint := "https://test.metaname.net/api/1.1"
-	val, ok := os.LookupEnv("api_endpoint")
-	if ok {
-		endpoint = val
-	}
 	provider := metaname.Provider{APIKey: os.Getenv("api_key"),
 		AccountReference: os.Getenv("account_reference"),
-		Endpoint:         endpoint}
+		Environment:      "test",
+		Endpoint:         os.Getenv("api_endpoint")}
 	zone := os.Args[1]
 	recs, err := provider.GetRecords(ctx, zone)
 	if err != nil {
 		fmt.Println(err)
 	}
+	sortForDisplay(recs)
 	for _, r := range recs {
-		fmt.Println(r.ID, r.Name, r.Type, r.Value)
+		// Metaname stores TTLs in whole seconds, as zone files write them.
+		fmt.Println(r.ID, r.Name, int64(r.TTL.Seconds()), "("+r.TTL.String()+")", r.Type, r.Value)
 	}
 
 }
+
+// sortForDisplay orders records by type, then name, so that output is
+// grouped by type and stable between runs. GetRecords already orders
+// records with the same type and name by value.
+func sortForDisplay(records []libdns.Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Type != records[j].Type {
+			return records[i].Type < records[j].Type
+		}
+		return records[i].Name < records[j].Name
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/metaname"
+)
+
+// Reads desired records from a file, one per line as
+//
+//	<name> <type> <ttl> <value>
+//
+// with "@" for the zone apex and "#" starting a comment, and prints the
+// changes that would bring the live zone in line with them. Nothing is
+// changed.
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Println("Usage: ", os.Args[0], "<zone>", "<records file>")
+		os.Exit(1)
+	}
+	ctx := context.TODO()
+	provider := metaname.Provider{APIKey: os.Getenv("api_key"),
+		AccountReference: os.Getenv("account_reference"),
+		Environment:      "test",
+		Endpoint:         os.Getenv("api_endpoint")}
+	zone := os.Args[1]
+	desired, err := readRecords(os.Args[2])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	diff, err := provider.PlanZone(ctx, zone, desired)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, r := range diff.Unchanged {
+		fmt.Println("  ", r.Name, r.Type, r.Value)
+	}
+	for _, u := range diff.Updates {
+		fmt.Println("~ ", u.Existing.Name, u.Existing.Type, u.Existing.Value, "->", u.Desired.Value, u.Desired.TTL)
+	}
+	for _, r := range diff.Creates {
+		fmt.Println("+ ", r.Name, r.Type, r.Value)
+	}
+	for _, r := range diff.Deletes {
+		fmt.Println("- ", r.Name, r.Type, r.Value)
+	}
+	fmt.Printf("%d unchanged, %d to update, %d to create, %d to delete\n",
+		len(diff.Unchanged), len(diff.Updates), len(diff.Creates), len(diff.Deletes))
+}
+
+func readRecords(path string) ([]libdns.Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []libdns.Record
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, " ", 4)
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("%s:%d: expected <name> <type> <ttl> <value>", path, line)
+		}
+		ttl, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: bad TTL %q", path, line, fields[2])
+		}
+		records = append(records, libdns.Record{
+			Name:  fields[0],
+			Type:  strings.ToUpper(fields[1]),
+			TTL:   time.Duration(ttl) * time.Second,
+			Value: strings.TrimSpace(fields[3]),
+		})
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,191 @@
+package metaname
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// forwardingTypes maps pseudo record types used for web and email
+// forwarding to the kind of forwarding they describe. Metaname's API
+// documentation doesn't say whether dns_zone lists forwarding at all; these
+// are the names such entries go by elsewhere, and since none is a DNS
+// record type, a record of one of them can't be a DNS record whatever it
+// holds. They are reported for a full picture of the zone but can't be
+// written.
+var forwardingTypes = map[string]string{
+	"URL":   "web",
+	"FRAME": "web",
+	"MAIL":  "email",
+}
+
+// validateRecords checks records for mistakes Metaname would reject with an
+// unhelpful error, so the caller gets a clear one before anything is sent.
+func validateRecords(records []libdns.Record) error {
+	for _, rec := range records {
+		if err := validateRecord(rec); err != nil {
+			return err
+		}
+	}
+	return validateCNAMEConflicts(records)
+}
+
+// validateCNAMEConflicts checks that no name in records has both a CNAME
+// and a record of another type, or two different CNAMEs, which Metaname
+// would reject partway through a batch.
+func validateCNAMEConflicts(records []libdns.Record) error {
+	cnames := make(map[string]libdns.Record)
+	for _, rec := range records {
+		if rec.Type != "CNAME" {
+			continue
+		}
+		name := strings.ToLower(rec.Name)
+		if other, ok := cnames[name]; ok && !valuesMatch("CNAME", other.Value, rec.Value) {
+			return fmt.Errorf("invalid records: CNAME %s is given as both %q and %q, but a name can have only one CNAME",
+				displayName(rec.Name), other.Value, rec.Value)
+		}
+		cnames[name] = rec
+	}
+	for _, rec := range records {
+		if _, ok := cnames[strings.ToLower(rec.Name)]; ok && rec.Type != "" && rec.Type != "CNAME" {
+			return fmt.Errorf("invalid records: %s %s conflicts with a CNAME at the same name", rec.Type, displayName(rec.Name))
+		}
+	}
+	return nil
+}
+
+// displayName names the zone apex "@" for messages.
+func displayName(name string) string {
+	if name == "" {
+		return "@"
+	}
+	return name
+}
+
+// maxRDataLength is the most data a DNS record can hold. Metaname documents
+// no lower limit of its own.
+const maxRDataLength = 65535
+
+// txtDataLength returns the length of the record data a TXT value becomes:
+// the value split into character-strings of at most maxTXTString bytes,
+// each preceded by a length byte.
+func txtDataLength(value string) int {
+	chunks := (len(value) + maxTXTString - 1) / maxTXTString
+	if chunks == 0 {
+		chunks = 1
+	}
+	return len(value) + chunks
+}
+
+func validateRecord(rec libdns.Record) error {
+	// A zero TTL is never sent, leaving the TTL to DefaultTTL, Metaname, or
+	// the existing record, but a negative one can only be a mistake.
+	if rec.TTL < 0 {
+		return fmt.Errorf("invalid record: %s %s has negative TTL %s", rec.Type, displayName(rec.Name), rec.TTL)
+	}
+	if _, ok := forwardingTypes[rec.Type]; ok {
+		return fmt.Errorf("invalid record: %s forwarding entries are read-only through this provider", rec.Type)
+	}
+	if rec.Type == "CNAME" && (rec.Name == "" || rec.Name == "@") {
+		return fmt.Errorf("invalid record: a CNAME cannot be created at the zone apex")
+	}
+	if rec.Type == "CNAME" {
+		if err := validateHostname(rec.Value); err != nil {
+			return fmt.Errorf("invalid record: CNAME %s target %q %v", displayName(rec.Name), rec.Value, err)
+		}
+	}
+	if rec.Type == "TXT" {
+		if n := txtDataLength(rec.Value); n > maxRDataLength {
+			return fmt.Errorf("invalid record: TXT %s is too long: its %d bytes become %d bytes of record data, more than the %d a record can hold",
+				displayName(rec.Name), len(rec.Value), n, maxRDataLength)
+		}
+	}
+	if rec.Type == "MX" {
+		// A null MX, declaring that the name accepts no mail, must have
+		// preference 0 (RFC 7505).
+		if pref, target, ok := splitAux(rec.Value, 2); ok && target == "." && pref != 0 {
+			return fmt.Errorf("invalid record: a null MX at %s must have preference 0", displayName(rec.Name))
+		}
+	}
+	return nil
+}
+
+// validateHostname checks that target is a hostname in presentation
+// format, relative or fully qualified, or "@" for the zone apex: labels of
+// letters, digits, hyphens, and underscores, none empty or over 63
+// characters. Any other character must be escaped, as \c or \DDD, which
+// counts as the one character it stands for; records are checked after
+// escapeTarget, so the characters it escapes are accepted, as are targets
+// read back from Metaname. Its error completes a sentence about the target.
+func validateHostname(target string) error {
+	if target == "@" {
+		return nil
+	}
+	if target == "" || target == "." {
+		return fmt.Errorf("is empty")
+	}
+	total, label := 0, 0
+	for i := 0; i < len(target); i++ {
+		c := target[i]
+		switch {
+		case c == '.':
+			if label == 0 {
+				return fmt.Errorf("has an empty label")
+			}
+			total += label + 1
+			label = 0
+			continue
+		case c == '\\':
+			if i+3 < len(target) && isDigits(target[i+1:i+4]) {
+				i += 3
+			} else if i+1 < len(target) {
+				i++
+			} else {
+				return fmt.Errorf("ends with an incomplete escape")
+			}
+		case !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'):
+			return fmt.Errorf("contains %q, which a hostname can't unless it is escaped", c)
+		}
+		label++
+		if label > 63 {
+			return fmt.Errorf("has a label longer than 63 characters")
+		}
+	}
+	if label == 0 {
+		// A trailing dot makes the name fully qualified.
+		total--
+	}
+	if total+label > 253 {
+		return fmt.Errorf("is longer than 253 characters")
+	}
+	return nil
+}
+
+// isDigits reports whether s is made up only of decimal digits.
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// validateZone checks that zone is plausibly a domain name, since Metaname's
+// error for a malformed one is confusing.
+func validateZone(zone string) error {
+	name := strings.TrimSuffix(zone, ".")
+	if name == "" {
+		return fmt.Errorf("invalid zone: zone name is empty")
+	}
+	if strings.ContainsAny(name, " \t\r\n") {
+		return fmt.Errorf("invalid zone %q: zone name contains whitespace", zone)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return fmt.Errorf("invalid zone %q: zone name has an empty label", zone)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package metaname
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestApexCNAMERejected(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	for _, name := range []string{"", "@"} {
+		_, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+			{Name: name, Type: "CNAME", Value: "example.net.", TTL: 300},
+		})
+		if err == nil || !strings.Contains(err.Error(), "zone apex") {
+			t.Fatalf("expected apex CNAME validation error for name %q; got %v", name, err)
+		}
+		_, err = p.SetRecords(context.Background(), "example.com", []libdns.Record{
+			{Name: name, Type: "CNAME", Value: "example.net.", TTL: 300},
+		})
+		if err == nil || !strings.Contains(err.Error(), "zone apex") {
+			t.Fatalf("expected apex CNAME validation error for name %q; got %v", name, err)
+		}
+	}
+	if n := len(f.calls); n != 0 {
+		t.Fatalf("expected no API calls; got %d", n)
+	}
+}
+
+func TestNegativeTTLRejected(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	records := []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.1", TTL: -time.Minute}}
+	if _, err := p.AppendRecords(context.Background(), "example.com", records); err == nil || !strings.Contains(err.Error(), "negative TTL") {
+		t.Fatalf("expected negative TTL validation error; got %v", err)
+	}
+	if _, err := p.SetRecords(context.Background(), "example.com", records); err == nil || !strings.Contains(err.Error(), "negative TTL") {
+		t.Fatalf("expected negative TTL validation error; got %v", err)
+	}
+	if n := len(f.calls); n != 0 {
+		t.Fatalf("expected no API calls; got %d", n)
+	}
+}
+
+func TestEmptyZoneRejected(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+	ctx := context.Background()
+	recs := []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300}}
+
+	for _, zone := range []string{"", ".", "bad zone.com", "example..com"} {
+		if _, err := p.GetRecords(ctx, zone); err == nil {
+			t.Fatalf("expected GetRecords to reject zone %q", zone)
+		}
+		if _, err := p.AppendRecords(ctx, zone, recs); err == nil {
+			t.Fatalf("expected AppendRecords to reject zone %q", zone)
+		}
+		if _, err := p.SetRecords(ctx, zone, recs); err == nil {
+			t.Fatalf("expected SetRecords to reject zone %q", zone)
+		}
+		if _, err := p.DeleteRecords(ctx, zone, recs); err == nil {
+			t.Fatalf("expected DeleteRecords to reject zone %q", zone)
+		}
+	}
+	if _, err := p.GetRecords(ctx, ""); err == nil || !strings.Contains(err.Error(), "zone name is empty") {
+		t.Fatalf("expected a clear empty-zone error; got %v", err)
+	}
+	if n := len(f.calls); n != 0 {
+		t.Fatalf("expected no API calls; got %d", n)
+	}
+}
+
+func TestConflictingSetRejected(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "ok", Type: "TXT", Value: "fine", TTL: 300},
+		{Name: "www", Type: "CNAME", Value: "example.net.", TTL: 300},
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300},
+	})
+	if err == nil || !strings.Contains(err.Error(), "conflicts with a CNAME") {
+		t.Fatalf("expected CNAME conflict error; got %v", err)
+	}
+	if _, err := p.ApplyZone(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300},
+		{Name: "www", Type: "CNAME", Value: "example.net.", TTL: 300},
+	}); err == nil {
+		t.Fatal("expected CNAME conflict error from ApplyZone")
+	}
+	if n := len(f.calls); n != 0 {
+		t.Fatalf("expected no API calls; got %d", n)
+	}
+}
+
+func TestDuplicateCNAMEsRejected(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "www", Type: "CNAME", Value: "one.example.net.", TTL: 300},
+		{Name: "WWW", Type: "CNAME", Value: "two.example.net.", TTL: 300},
+	})
+	if err == nil || !strings.Contains(err.Error(), "one.example.net.") || !strings.Contains(err.Error(), "two.example.net.") {
+		t.Fatalf("expected an error naming both CNAMEs; got %v", err)
+	}
+	if n := len(f.calls); n != 0 {
+		t.Fatalf("expected no API calls; got %d", n)
+	}
+}
+
+func TestLongTXTRejected(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	_, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "big", Type: "TXT", Value: strings.Repeat("x", 65280), TTL: 300},
+	})
+	if err == nil || !strings.Contains(err.Error(), "65535") || !strings.Contains(err.Error(), "65536") {
+		t.Fatalf("expected an error naming the limit and the length; got %v", err)
+	}
+	if n := len(f.calls); n != 0 {
+		t.Fatalf("expected no API calls; got %d", n)
+	}
+
+	// The longest value that fits is accepted.
+	if _, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Name: "big", Type: "TXT", Value: strings.Repeat("x", 65279), TTL: 300},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidCNAMETargetRejected(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	for _, target := range []string{"a/b.example.net", "bad!.example.net.", "a..example.net", ""} {
+		_, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+			{Name: "alias", Type: "CNAME", Value: target, TTL: 300},
+		})
+		if err == nil || !strings.Contains(err.Error(), "CNAME alias target") {
+			t.Fatalf("expected a clear error for target %q; got %v", target, err)
+		}
+	}
+	if n := len(f.calls); n != 0 {
+		t.Fatalf("expected no API calls; got %d", n)
+	}
+
+	for _, target := range []string{"www", "target.example.net", "_service.example.net.", "@", "not a host.example.net", `a\.b.example.net.`} {
+		if _, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+			{Name: "alias", Type: "CNAME", Value: target, TTL: 300},
+		}); err != nil {
+			t.Fatalf("expected target %q to be accepted; got %v", target, err)
+		}
+	}
+}
+
+func TestEscapedCNAMEWrittenBack(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "raw", "type": "CNAME", "ttl": 300, "data": "with space.example.net."})
+	p := f.provider()
+
+	records, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Value != `with\ space.example.net.` {
+		t.Fatalf("expected the CNAME read back escaped; got %+v", records)
+	}
+	records[0].TTL = 600 * time.Second
+	if _, err := p.SetRecords(context.Background(), "example.com", records); err != nil {
+		t.Fatalf("expected the CNAME as read to be accepted by SetRecords; got %v", err)
+	}
+	if _, err := p.ApplyZone(context.Background(), "example.com", records); err != nil {
+		t.Fatalf("expected the CNAME as read to be accepted by ApplyZone; got %v", err)
+	}
+	stored := f.records("example.com")
+	if len(stored) != 1 || fmt.Sprint(stored[0]["ttl"]) != "600" {
+		t.Fatalf("expected the one CNAME updated in place; got %v", stored)
+	}
+}
@@ -0,0 +1,198 @@
+package metaname
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// maxTXTString is the longest character-string a TXT record can hold; longer
+// values are written as several strings.
+const maxTXTString = 255
+
+// ExportZoneFile returns every record in the zone, including the SOA and NS
+// records where Metaname lists them, as an RFC 1035 zone file. Names are
+// written relative to an $ORIGIN of the zone, with "@" for the apex.
+// Forwarding entries aren't DNS records, so they're left out.
+// ParseZoneLine reads each record line back.
+func (p *Provider) ExportZoneFile(ctx context.Context, zone string) (string, error) {
+	records, err := p.GetCustomRecords(ctx, zone)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "$ORIGIN %s.\n", strings.TrimSuffix(zone, "."))
+	for _, rec := range records {
+		if _, ok := rec.Metadata["forwarding"]; ok {
+			continue
+		}
+		name := rec.Name
+		if name == "" {
+			name = "@"
+		}
+		value := rec.Value
+		if rec.Type == "TXT" {
+			value = quoteTXT(value)
+		}
+		fmt.Fprintf(&b, "%s\t%d\tIN\t%s\t%s\n", name, ttlSeconds(rec.TTL), rec.Type, value)
+	}
+	return b.String(), nil
+}
+
+// ImportZoneFile reads an RFC 1035 zone file, such as a dump from another
+// provider, and adds its records to the zone as AppendRecords does,
+// returning the records added. The SOA and apex NS records are skipped,
+// since Metaname manages those itself. Lines are read as ParseZoneLine
+// reads them, and nothing is added if any line can't be parsed.
+func (p *Provider) ImportZoneFile(ctx context.Context, zone string, zoneFile io.Reader) ([]libdns.Record, error) {
+	var records []libdns.Record
+	scanner := bufio.NewScanner(zoneFile)
+	line := 0
+	for scanner.Scan() {
+		line++
+		rec, err := ParseZoneLine(zone, scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if rec.Type == "" || rec.Type == "SOA" || (rec.Type == "NS" && rec.Name == "") {
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p.AppendRecords(ctx, zone, records)
+}
+
+// ParseZoneLine parses one line of an RFC 1035 zone file, such as
+// ExportZoneFile writes, into a record in zone. The TTL and class may be
+// omitted, and names may be given relative to the zone or fully qualified.
+// A line holding no record, being blank, a comment, or a directive such as
+// $ORIGIN, gives a record with no type and no error. Lines that inherit the
+// previous line's name, and records spanning several lines, aren't
+// supported.
+func ParseZoneLine(zone, line string) (libdns.Record, error) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "$") {
+		return libdns.Record{}, nil
+	}
+	if line[0] == ' ' || line[0] == '\t' {
+		return libdns.Record{}, fmt.Errorf("invalid zone file line %q: a record must begin with its name", line)
+	}
+	fields, err := zoneFields(trimmed)
+	if err != nil {
+		return libdns.Record{}, fmt.Errorf("invalid zone file line %q: %w", line, err)
+	}
+
+	rec := libdns.Record{Name: relativeName(fields[0], zone)}
+	i := 1
+	for ; i < len(fields) && i <= 2; i++ {
+		if strings.HasPrefix(fields[i], "\"") {
+			break
+		}
+		if ttl, err := strconv.Atoi(fields[i]); err == nil {
+			rec.TTL = time.Duration(ttl) * time.Second
+		} else if !strings.EqualFold(fields[i], "IN") {
+			break
+		}
+	}
+	if i >= len(fields)-1 {
+		return libdns.Record{}, fmt.Errorf("invalid zone file line %q: expected a type and data", line)
+	}
+	rec.Type = strings.ToUpper(fields[i])
+
+	rdata := fields[i+1:]
+	if rec.Type == "TXT" {
+		var value strings.Builder
+		for _, s := range rdata {
+			value.WriteString(unquoteTXT(s))
+		}
+		rec.Value = value.String()
+	} else {
+		rec.Value = strings.Join(rdata, " ")
+	}
+	return rec, nil
+}
+
+// zoneFields splits a zone file line into its fields, stopping at a comment
+// and keeping quoted strings, quotes and all, as single fields.
+func zoneFields(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inField, quoted, escaped := false, false, false
+	for _, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == ';':
+			if inField {
+				fields = append(fields, field.String())
+			}
+			return fields, nil
+		case !quoted && (c == ' ' || c == '\t'):
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+			continue
+		}
+		field.WriteRune(c)
+		inField = true
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quoted string")
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// quoteTXT writes value as one or more quoted character-strings.
+func quoteTXT(value string) string {
+	var parts []string
+	for {
+		chunk := value
+		if len(chunk) > maxTXTString {
+			chunk = chunk[:maxTXTString]
+		}
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(chunk)
+		parts = append(parts, `"`+escaped+`"`)
+		value = value[len(chunk):]
+		if value == "" {
+			return strings.Join(parts, " ")
+		}
+	}
+}
+
+// unquoteTXT reverses quoteTXT for one character-string. An unquoted string
+// is returned as it is.
+func unquoteTXT(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	escaped := false
+	for _, c := range s {
+		if !escaped && c == '\\' {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,143 @@
+package metaname
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestExportZoneFileRoundTrip(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "NS", "ttl": 86400, "data": "ns1.metaname.net."})
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "_dmarc", "type": "TXT", "ttl": 3600, "data": `v=DMARC1; p=none; note "quoted"`})
+	f.addRecord("example.com", map[string]interface{}{"name": "long", "type": "TXT", "ttl": 3600, "data": strings.Repeat("x", 300)})
+	f.addRecord("example.com", map[string]interface{}{"name": "alias", "type": "CNAME", "ttl": 600, "data": "www.example.com."})
+	f.addRecord("example.com", map[string]interface{}{"name": "@", "type": "MX", "ttl": 3600, "aux": 10, "data": "mail.example.com."})
+	p := f.provider()
+
+	exported, err := p.ExportZoneFile(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(exported, "$ORIGIN example.com.\n") {
+		t.Fatalf("expected an $ORIGIN line first; got %q", exported)
+	}
+	if !strings.Contains(exported, "@\t3600\tIN\tMX\t10 mail.example.com.\n") {
+		t.Fatalf("expected the MX preference in the export; got %q", exported)
+	}
+
+	want, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []libdns.Record
+	for _, line := range strings.Split(exported, "\n") {
+		rec, err := ParseZoneLine("example.com", line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Type != "" {
+			got = append(got, rec)
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d records back; got %d", len(want), len(got))
+	}
+	for i := range want {
+		w := want[i]
+		w.ID = ""
+		if got[i] != w {
+			t.Fatalf("expected %+v to round-trip; got %+v", w, got[i])
+		}
+	}
+}
+
+func TestParseZoneLine(t *testing.T) {
+	for line, want := range map[string]libdns.Record{
+		"www.example.com. IN 300 A 192.0.2.1 ; web": {Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300 * time.Second},
+		"@ txt \"a b\" \"c\"":                       {Name: "", Type: "TXT", Value: "a bc"},
+		"; just a comment":                          {},
+		"$TTL 3600":                                 {},
+	} {
+		got, err := ParseZoneLine("example.com", line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("expected %q to parse as %+v; got %+v", line, want, got)
+		}
+	}
+	for _, line := range []string{"\tA 192.0.2.1", "www 300 IN", `www TXT "open`} {
+		if _, err := ParseZoneLine("example.com", line); err == nil {
+			t.Fatalf("expected an error parsing %q", line)
+		}
+	}
+}
+
+func TestImportZoneFile(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	p := f.provider()
+
+	zoneFile := `$ORIGIN example.com.
+$TTL 3600
+@	3600	IN	SOA	ns1.other.net. hostmaster.example.com. 1 7200 900 1209600 300
+@	3600	IN	NS	ns1.other.net.
+; the web server
+www	300	IN	A	192.0.2.1
+mail.example.com.	300	IN	A	192.0.2.2
+@	3600	IN	MX	10 mail.example.com.
+@	3600	IN	TXT	"v=spf1 mx -all"
+`
+	added, err := p.ImportZoneFile(context.Background(), "example.com", strings.NewReader(zoneFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 4 {
+		t.Fatalf("expected 4 records added; got %+v", added)
+	}
+	types := map[string]bool{}
+	for _, rec := range f.records("example.com") {
+		types[rec["name"].(string)+" "+rec["type"].(string)] = true
+	}
+	for _, want := range []string{"www A", "mail A", "@ MX", "@ TXT"} {
+		if !types[want] {
+			t.Fatalf("expected %s to be created; got %v", want, types)
+		}
+	}
+
+	_, err = p.ImportZoneFile(context.Background(), "example.com", strings.NewReader("ok 300 IN A 192.0.2.3\nbad 300 IN\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected a parse error naming line 2; got %v", err)
+	}
+	if n := len(f.records("example.com")); n != 4 {
+		t.Fatalf("expected nothing added from a file that fails to parse; got %d records", n)
+	}
+}
+
+func TestExportZoneFileSkipsForwarding(t *testing.T) {
+	f := newFakeMetaname(t, "example.com")
+	f.addRecord("example.com", map[string]interface{}{"name": "www", "type": "A", "ttl": 300, "data": "192.0.2.1"})
+	f.addRecord("example.com", map[string]interface{}{"name": "fwd", "type": "URL", "ttl": 300, "data": "http://example.net/"})
+	p := f.provider()
+
+	exported, err := p.ExportZoneFile(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(exported, "URL") {
+		t.Fatalf("expected the forwarding entry left out; got %q", exported)
+	}
+
+	fresh := newFakeMetaname(t, "example.com")
+	added, err := fresh.provider().ImportZoneFile(context.Background(), "example.com", strings.NewReader(exported))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 || added[0].Name != "www" {
+		t.Fatalf("expected www imported; got %+v", added)
+	}
+}